@@ -48,11 +48,6 @@ const (
 	WHITE_SQUARES uint64 = 0x55AA55AA55AA55AA
 	BLACK_SQUARES uint64 = 0xAA55AA55AA55AA55
 
-	WHITE_KING_CASTLE_BLOCK_BB  uint64 = F1_BB | G1_BB
-	WHITE_QUEEN_CASTLE_BLOCK_BB uint64 = B1_BB | C1_BB | D1_BB
-	BLACK_KING_CASTLE_BLOCK_BB  uint64 = F8_BB | G8_BB
-	BLACK_QUEEN_CASTLE_BLOCK_BB uint64 = B8_BB | C8_BB | D8_BB
-
 	PROMOTION_RANKS uint64 = RANK_1_BB | RANK_8_BB
 	CENTER          uint64 = (FILE_D_BB | FILE_E_BB) & (RANK_4_BB | RANK_5_BB)
 	LONG_DIAGONALS  uint64 = 0x8142241818244281
@@ -0,0 +1,245 @@
+package backend
+
+import "errors"
+
+const (
+	KingSide = iota
+	QueenSide
+)
+
+// Flags set in Position.Flags when right is lost, indexed by [colour][side]
+var castlingRightFlags = [2][2]uint8{
+	{BlackKingSideCastleFlag, BlackQueenSideCastleFlag},
+	{WhiteKingSideCastleFlag, WhiteQueenSideCastleFlag},
+}
+
+// castlingInfo describes initial placement of kings and castling rooks.
+// It is shared by all positions of a game, so it is never modified after creation.
+// Castling move is encoded as king capturing its own rook.
+type castlingInfo struct {
+	// Castling rights lost when piece moves from or to square
+	flags    [64]uint8
+	kingFrom [2]int
+	rookFrom [2][2]int
+	moves    [2][2]Move
+	// Squares that have to be empty
+	block [2][2]uint64
+	// Squares king passes through that cannot be attacked,
+	// destination is checked after making the move
+	path [2][2]uint64
+}
+
+var standardCastling = newCastlingInfo([2]int{E8, E1}, [2][2]int{{H8, A8}, {H1, A1}})
+
+func newCastlingInfo(kingFrom [2]int, rookFrom [2][2]int) *castlingInfo {
+	res := &castlingInfo{kingFrom: kingFrom, rookFrom: rookFrom}
+	for colour := Black; colour <= White; colour++ {
+		res.flags[kingFrom[colour]] |= castlingRightFlags[colour][KingSide] | castlingRightFlags[colour][QueenSide]
+		for side := KingSide; side <= QueenSide; side++ {
+			rook := rookFrom[colour][side]
+			kingTo, rookTo := castlingDestinations(colour, side)
+			res.flags[rook] |= castlingRightFlags[colour][side]
+			if side == KingSide {
+				res.moves[colour][side] = NewMove(kingFrom[colour], rook, King, None, KingCastle)
+			} else {
+				res.moves[colour][side] = NewMove(kingFrom[colour], rook, King, None, QueenCastle)
+			}
+			occupied := uint64(1)<<uint(kingFrom[colour]) | uint64(1)<<uint(rook)
+			res.block[colour][side] = (squaresBetween(kingFrom[colour], kingTo) | squaresBetween(rook, rookTo)) &^ occupied
+			res.path[colour][side] = squaresBetween(kingFrom[colour], kingTo) &^ (uint64(1) << uint(kingTo))
+		}
+	}
+	return res
+}
+
+// Castling destinations are the same as in standard chess
+func castlingDestinations(colour, side int) (kingTo, rookTo int) {
+	rank := 0
+	if colour == Black {
+		rank = 56
+	}
+	if side == KingSide {
+		return G1 + rank, F1 + rank
+	}
+	return C1 + rank, D1 + rank
+}
+
+// squaresBetween returns squares on the same rank from a to b, both inclusive
+func squaresBetween(a, b int) (res uint64) {
+	if a > b {
+		a, b = b, a
+	}
+	for sq := a; sq <= b; sq++ {
+		res |= uint64(1) << uint(sq)
+	}
+	return
+}
+
+func castlingSide(move Move) int {
+	if move.Type() == KingCastle {
+		return KingSide
+	}
+	return QueenSide
+}
+
+// Positions built without FEN have no castling info and use standard castling
+func (pos *Position) castlingRules() *castlingInfo {
+	if pos.castling == nil {
+		return standardCastling
+	}
+	return pos.castling
+}
+
+func (pos *Position) canCastle(info *castlingInfo, side int) bool {
+	colour := pos.SideToMove
+	return pos.Flags&castlingRightFlags[colour][side] == 0 &&
+		(pos.Colours[White]|pos.Colours[Black])&info.block[colour][side] == 0 &&
+		!pos.isCastlingPathAttacked(info.path[colour][side], colour^1)
+}
+
+func (pos *Position) isCastlingPathAttacked(path uint64, side int) bool {
+	for ; path != 0; path &= path - 1 {
+		if pos.IsSquareAttacked(BitScan(path), side) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Position) castle(move Move, colour int) {
+	from, rookFrom := move.From(), move.To()
+	kingTo, rookTo := castlingDestinations(colour, castlingSide(move))
+	// King or rook can stay on its square or land on square of the other piece,
+	// so pieces are removed first and then put on destination squares
+	p.Colours[colour] = (p.Colours[colour] &^ (SquareMask[from] | SquareMask[rookFrom])) | SquareMask[kingTo] | SquareMask[rookTo]
+	p.Pieces[King] = (p.Pieces[King] &^ SquareMask[from]) | SquareMask[kingTo]
+	p.Pieces[Rook] = (p.Pieces[Rook] &^ SquareMask[rookFrom]) | SquareMask[rookTo]
+	p.Key ^= zobrist[King][colour][from] ^ zobrist[King][colour][kingTo] ^ zobrist[Rook][colour][rookFrom] ^ zobrist[Rook][colour][rookTo]
+	p.PawnKey ^= zobrist[King][colour][from] ^ zobrist[King][colour][kingTo]
+}
+
+// IsChess960 reports if castling pieces are not placed as in standard chess
+func (pos *Position) IsChess960() bool {
+	return pos.castlingRules() != standardCastling
+}
+
+// parseCastling sets castling rights and castling rooks from FEN castling field.
+// Standard, X-FEN (KQkq meaning outermost rook) and Shredder-FEN (rook files) are supported.
+func (pos *Position) parseCastling(field string) {
+	kingFrom := standardCastling.kingFrom
+	rookFrom := standardCastling.rookFrom
+	// Kings of sides without castling rights are assumed to be on standard squares
+	var actualKingFrom [2]int
+	for colour := Black; colour <= White; colour++ {
+		actualKingFrom[colour] = kingFrom[colour]
+		if king := pos.Pieces[King] & pos.Colours[colour]; king != 0 {
+			actualKingFrom[colour] = BitScan(king)
+		}
+	}
+	for _, char := range field {
+		var colour, side, rook int
+		switch {
+		case char == 'K' || char == 'Q' || char == 'k' || char == 'q':
+			colour = White
+			if char == 'k' || char == 'q' {
+				colour = Black
+			}
+			side = KingSide
+			if char == 'Q' || char == 'q' {
+				side = QueenSide
+			}
+			rook = pos.outermostRook(colour, side, actualKingFrom[colour], rookFrom[colour][side])
+		case char >= 'A' && char <= 'H':
+			colour, rook = White, int(char-'A')
+		case char >= 'a' && char <= 'h':
+			colour, rook = Black, int(char-'a')+56
+		default:
+			continue
+		}
+		if char >= 'A' && char <= 'H' || char >= 'a' && char <= 'h' {
+			side = KingSide
+			if File(rook) < File(actualKingFrom[colour]) {
+				side = QueenSide
+			}
+		}
+		kingFrom[colour] = actualKingFrom[colour]
+		rookFrom[colour][side] = rook
+		pos.Flags &^= castlingRightFlags[colour][side]
+	}
+	if kingFrom == standardCastling.kingFrom && rookFrom == standardCastling.rookFrom {
+		pos.castling = standardCastling
+	} else {
+		pos.castling = newCastlingInfo(kingFrom, rookFrom)
+	}
+}
+
+// outermostRook finds rook closest to the corner on given side of the king
+func (pos *Position) outermostRook(colour, side, kingSquare, fallback int) int {
+	rooks := pos.Pieces[Rook] & pos.Colours[colour]
+	rank := kingSquare &^ 7
+	if side == KingSide {
+		for sq := rank + 7; sq > kingSquare; sq-- {
+			if rooks&(uint64(1)<<uint(sq)) != 0 {
+				return sq
+			}
+		}
+	} else {
+		for sq := rank; sq < kingSquare; sq++ {
+			if rooks&(uint64(1)<<uint(sq)) != 0 {
+				return sq
+			}
+		}
+	}
+	return fallback
+}
+
+// castlingString returns castling field of FEN.
+// Rook file is used only when castling rook is not the outermost one.
+func (pos *Position) castlingString() string {
+	var res string
+	for _, colour := range [...]int{White, Black} {
+		for side := KingSide; side <= QueenSide; side++ {
+			if pos.Flags&castlingRightFlags[colour][side] != 0 {
+				continue
+			}
+			rook := pos.castlingRules().rookFrom[colour][side]
+			var char byte
+			if pos.outermostRook(colour, side, pos.castlingRules().kingFrom[colour], NoSquare) == rook {
+				char = "KQ"[side]
+			} else {
+				char = byte('A' + File(rook))
+			}
+			if colour == Black {
+				char += 'a' - 'A'
+			}
+			res += string(char)
+		}
+	}
+	if res == "" {
+		return "-"
+	}
+	return res
+}
+
+// validateCastlingPlacement checks if king and rooks stand on the squares from which they castle
+func (pos *Position) validateCastlingPlacement() error {
+	for colour := Black; colour <= White; colour++ {
+		king := pos.castlingRules().kingFrom[colour]
+		backRank := 0
+		if colour == Black {
+			backRank = RANK_8
+		}
+		for side := KingSide; side <= QueenSide; side++ {
+			if pos.Flags&castlingRightFlags[colour][side] != 0 {
+				continue
+			}
+			rook := pos.castlingRules().rookFrom[colour][side]
+			if pos.Pieces[King]&pos.Colours[colour]&SquareMask[king] == 0 || Rank(king) != backRank ||
+				pos.Pieces[Rook]&pos.Colours[colour]&SquareMask[rook] == 0 || Rank(rook) != backRank ||
+				(side == KingSide) != (rook > king) {
+				return errors.New("castling rights do not match king and rook placement")
+			}
+		}
+	}
+	return nil
+}
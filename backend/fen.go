@@ -1,6 +1,8 @@
 package backend
 
 import (
+	"errors"
+	"fmt"
 	"github.com/mhib/combusken/utils"
 	"strconv"
 	"strings"
@@ -32,18 +34,7 @@ func ParseFen(input string) Position {
 
 	res.SideToMove = utils.BoolToInt(slices[1] == "w")
 
-	for _, char := range slices[2] {
-		switch char {
-		case 'K':
-			res.Flags ^= WhiteKingSideCastleFlag
-		case 'Q':
-			res.Flags ^= WhiteQueenSideCastleFlag
-		case 'q':
-			res.Flags ^= BlackQueenSideCastleFlag
-		case 'k':
-			res.Flags ^= BlackKingSideCastleFlag
-		}
-	}
+	res.parseCastling(slices[2])
 
 	if len(slices) >= 4 && slices[3] != "-" {
 		square := (int(slices[3][0]) - int('a')) + (int(slices[3][1])-int('1'))*8
@@ -59,11 +50,190 @@ func ParseFen(input string) Position {
 		res.FiftyMove = parsed
 	}
 
+	res.FullMove = 1
+	if len(slices) >= 6 {
+		if parsed, err := strconv.Atoi(slices[5]); err == nil && parsed > 0 {
+			res.FullMove = parsed
+		}
+	}
+
 	HashPosition(&res)
 
 	return res
 }
 
+// ParseFenStrict parses FEN like ParseFen, but returns error instead of accepting malformed
+// or illegal positions. Half move clock and full move number are optional.
+func ParseFenStrict(input string) (Position, error) {
+	slices := strings.Fields(input)
+	if len(slices) < 4 || len(slices) > 6 {
+		return Position{}, errors.New("FEN should have from 4 to 6 fields")
+	}
+	if err := validatePiecePlacement(slices[0]); err != nil {
+		return Position{}, err
+	}
+	if slices[1] != "w" && slices[1] != "b" {
+		return Position{}, fmt.Errorf("invalid side to move %q", slices[1])
+	}
+	if err := validateCastling(slices[2]); err != nil {
+		return Position{}, err
+	}
+	if slices[3] != "-" && (len(slices[3]) != 2 || slices[3][0] < 'a' || slices[3][0] > 'h' ||
+		(slices[1] == "w" && slices[3][1] != '6') || (slices[1] == "b" && slices[3][1] != '3')) {
+		return Position{}, fmt.Errorf("invalid en passant square %q", slices[3])
+	}
+	for _, counter := range slices[4:] {
+		if parsed, err := strconv.Atoi(counter); err != nil || parsed < 0 {
+			return Position{}, fmt.Errorf("invalid move counter %q", counter)
+		}
+	}
+	if len(slices) == 6 && slices[5] == "0" {
+		return Position{}, errors.New("full move number should be positive")
+	}
+
+	res := ParseFen(strings.Join(slices, " "))
+	if err := res.validate(); err != nil {
+		return Position{}, err
+	}
+	return res, nil
+}
+
+func validatePiecePlacement(placement string) error {
+	ranks := strings.Split(placement, "/")
+	if len(ranks) != 8 {
+		return fmt.Errorf("expected 8 ranks, got %d", len(ranks))
+	}
+	for idx, rank := range ranks {
+		files := 0
+		lastDigit := false
+		for _, char := range rank {
+			if char >= '1' && char <= '8' {
+				if lastDigit {
+					return fmt.Errorf("consecutive digits in rank %d", 8-idx)
+				}
+				files += int(char - '0')
+				lastDigit = true
+			} else if strings.ContainsRune("pnbrqkPNBRQK", char) {
+				files++
+				lastDigit = false
+			} else {
+				return fmt.Errorf("invalid piece %q", char)
+			}
+		}
+		if files != 8 {
+			return fmt.Errorf("rank %d has %d files", 8-idx, files)
+		}
+	}
+	return nil
+}
+
+func validateCastling(castling string) error {
+	if castling == "-" {
+		return nil
+	}
+	if castling == "" {
+		return errors.New("empty castling field")
+	}
+	for idx, char := range castling {
+		if !strings.ContainsRune("KQkqABCDEFGHabcdefgh", char) || strings.IndexRune(castling, char) != idx {
+			return fmt.Errorf("invalid castling rights %q", castling)
+		}
+	}
+	return nil
+}
+
+// validate checks if already parsed position is legal
+func (pos *Position) validate() error {
+	for colour := Black; colour <= White; colour++ {
+		if PopCount(pos.Pieces[King]&pos.Colours[colour]) != 1 {
+			return errors.New("each side should have exactly one king")
+		}
+		if PopCount(pos.Pieces[Pawn]&pos.Colours[colour]) > 8 || PopCount(pos.Colours[colour]) > 16 {
+			return errors.New("too many pieces")
+		}
+	}
+	if pos.Pieces[Pawn]&PROMOTION_RANKS != 0 {
+		return errors.New("pawns cannot be placed on first or last rank")
+	}
+
+	if err := pos.validateCastlingPlacement(); err != nil {
+		return err
+	}
+
+	// EpSquare is square of pawn that made double push
+	if pos.EpSquare != 0 {
+		var target, origin int
+		if pos.SideToMove == White {
+			target, origin = pos.EpSquare+8, pos.EpSquare+16
+		} else {
+			target, origin = pos.EpSquare-8, pos.EpSquare-16
+		}
+		occupancy := pos.Colours[White] | pos.Colours[Black]
+		if pos.Pieces[Pawn]&pos.Colours[pos.SideToMove^1]&SquareMask[pos.EpSquare] == 0 ||
+			occupancy&(SquareMask[target]|SquareMask[origin]) != 0 {
+			return errors.New("en passant square does not follow double pawn push")
+		}
+	}
+
+	if pos.IsSquareAttacked(BitScan(pos.Pieces[King]&pos.Colours[pos.SideToMove^1]), pos.SideToMove) {
+		return errors.New("side not to move is in check")
+	}
+	return nil
+}
+
+// Fen returns position in Forsyth-Edwards Notation
+func (pos *Position) Fen() string {
+	var sb strings.Builder
+	pieceChar := "pnbrqk"
+	for y := 7; y >= 0; y-- {
+		empty := 0
+		for x := 0; x <= 7; x++ {
+			bb := SquareMask[8*y+x]
+			piece := pos.TypeOnSquare(bb)
+			if piece == None {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				sb.WriteString(strconv.Itoa(empty))
+				empty = 0
+			}
+			char := rune(pieceChar[piece])
+			if pos.Colours[White]&bb != 0 {
+				char = unicode.ToUpper(char)
+			}
+			sb.WriteRune(char)
+		}
+		if empty > 0 {
+			sb.WriteString(strconv.Itoa(empty))
+		}
+		if y > 0 {
+			sb.WriteByte('/')
+		}
+	}
+
+	if pos.SideToMove == White {
+		sb.WriteString(" w ")
+	} else {
+		sb.WriteString(" b ")
+	}
+
+	sb.WriteString(pos.castlingString())
+
+	// EpSquare holds square of pawn that made double push
+	if pos.EpSquare == 0 {
+		sb.WriteString(" -")
+	} else if pos.SideToMove == White {
+		sb.WriteString(" " + SquareString[pos.EpSquare+8])
+	} else {
+		sb.WriteString(" " + SquareString[pos.EpSquare-8])
+	}
+
+	sb.WriteString(" " + strconv.Itoa(pos.FiftyMove))
+	sb.WriteString(" " + strconv.Itoa(utils.Max(1, pos.FullMove)))
+	return sb.String()
+}
+
 func insertPiece(pos *Position, piece rune, bit uint64) {
 	pos.Colours[utils.BoolToInt(unicode.IsUpper(piece))] |= bit
 	switch byte(unicode.ToLower(piece)) {
@@ -0,0 +1,136 @@
+package backend
+
+import "testing"
+
+func TestFenRoundTrip(t *testing.T) {
+	var fens = []string{
+		InitialPositionFen,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"rnbqkbnr/pp1ppppp/8/2p5/4P3/8/PPPP1PPP/RNBQKBNR w KQkq c6 0 2",
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		"4k3/8/8/8/8/8/8/4K2R b K - 37 70",
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w KQkq - 2 9",
+		"rk2r3/8/8/8/8/8/8/RK2R2R w EQq - 0 1",
+	}
+	for _, fen := range fens {
+		pos := ParseFen(fen)
+		if res := pos.Fen(); res != fen {
+			t.Errorf("expected %v, got %v", fen, res)
+		}
+	}
+}
+
+func TestFenAfterMoves(t *testing.T) {
+	pos := InitialPosition
+	for _, lan := range []string{"e2e4", "c7c5", "g1f3"} {
+		var ok bool
+		pos, ok = pos.MakeMoveLAN(lan)
+		if !ok {
+			t.Fatalf("illegal move %v", lan)
+		}
+	}
+	expected := "rnbqkbnr/pp1ppppp/8/2p5/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2"
+	if res := pos.Fen(); res != expected {
+		t.Errorf("expected %v, got %v", expected, res)
+	}
+}
+
+func TestChess960Castling(t *testing.T) {
+	var tests = []struct {
+		fen      string
+		lan      string
+		expected string
+	}{
+		{"4k3/8/8/8/8/8/8/1R2K1R1 w GB - 0 1", "e1g1", "4k3/8/8/8/8/8/8/1R3RK1 b - - 1 1"},
+		{"4k3/8/8/8/8/8/8/1R2K1R1 w GB - 0 1", "e1b1", "4k3/8/8/8/8/8/8/2KR2R1 b - - 1 1"},
+		{"4k3/8/8/8/8/8/8/RK4R1 w AG - 0 1", "b1g1", "4k3/8/8/8/8/8/8/R4RK1 b - - 1 1"},
+		{"4k3/8/8/8/8/8/8/RK4R1 w AG - 0 1", "b1a1", "4k3/8/8/8/8/8/8/2KR2R1 b - - 1 1"},
+	}
+	for _, test := range tests {
+		pos := ParseFen(test.fen)
+		if !pos.IsChess960() {
+			t.Errorf("expected Chess960 position %v", test.fen)
+		}
+		child, ok := pos.MakeMoveLAN(test.lan)
+		if !ok {
+			t.Errorf("illegal move %v in %v", test.lan, test.fen)
+			continue
+		}
+		if res := child.Fen(); res != test.expected {
+			t.Errorf("expected %v, got %v", test.expected, res)
+		}
+	}
+	if pos := ParseFen(InitialPositionFen); pos.IsChess960() {
+		t.Error("expected standard position")
+	}
+}
+
+func TestParseFenStrict(t *testing.T) {
+	var valid = []string{
+		InitialPositionFen,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq -",
+		"rnbqkbnr/pp1ppppp/8/2p5/4P3/8/PPPP1PPP/RNBQKBNR w KQkq c6 0 2",
+	}
+	for _, fen := range valid {
+		if _, err := ParseFenStrict(fen); err != nil {
+			t.Errorf("%v: unexpected error %v", fen, err)
+		}
+	}
+
+	var invalid = []string{
+		"",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbqkbnr/ppppxppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/44/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbq1bnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQ - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1",
+		"rnbqkbnp/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBN1 w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkqK - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e6 0 1",
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e6 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - x 1",
+		"4k3/8/8/8/8/8/8/4K2R w - - 0 1 extra",
+		"4k2R/8/8/8/8/8/8/4K3 w - - 0 1",
+	}
+	for _, fen := range invalid {
+		if _, err := ParseFenStrict(fen); err == nil {
+			t.Errorf("%v: expected error", fen)
+		}
+	}
+}
+
+func TestHandBuiltPosition(t *testing.T) {
+	// Position built without FEN uses standard castling
+	var pos Position
+	pos.Colours[White] = SquareMask[E1] | SquareMask[H1]
+	pos.Colours[Black] = SquareMask[E8]
+	pos.Pieces[King] = SquareMask[E1] | SquareMask[E8]
+	pos.Pieces[Rook] = SquareMask[H1]
+	pos.SideToMove = White
+	pos.Flags = WhiteQueenSideCastleFlag | BlackKingSideCastleFlag | BlackQueenSideCastleFlag
+	found := false
+	for _, move := range GenerateAllLegalMoves(&pos) {
+		if move.IsCastling() {
+			found = move.String() == "e1g1"
+		}
+	}
+	if !found {
+		t.Errorf("expected castling e1g1")
+	}
+	child, ok := pos.MakeMoveLAN("e1g1")
+	if !ok {
+		t.Fatal("castling is not legal")
+	}
+	if fen := child.Fen(); fen != "4k3/8/8/8/8/8/8/5RK1 b - - 1 1" {
+		t.Errorf("unexpected position after castling %v", fen)
+	}
+	if pos.IsChess960() {
+		t.Errorf("expected standard position")
+	}
+}
@@ -33,10 +33,11 @@ const (
 	NullMove = Move(0)
 )
 
-var WhiteKingSideCastle = NewMove(E1, G1, King, None, KingCastle)
-var WhiteQueenSideCastle = NewMove(E1, C1, King, None, QueenCastle)
-var BlackKingSideCastle = NewMove(E8, G8, King, None, KingCastle)
-var BlackQueenSideCastle = NewMove(E8, C8, King, None, QueenCastle)
+// Castling is encoded as king capturing its own rook
+var WhiteKingSideCastle = NewMove(E1, H1, King, None, KingCastle)
+var WhiteQueenSideCastle = NewMove(E1, A1, King, None, QueenCastle)
+var BlackKingSideCastle = NewMove(E8, H8, King, None, KingCastle)
+var BlackQueenSideCastle = NewMove(E8, A8, King, None, QueenCastle)
 
 func (m Move) From() int {
 	return int(m & 0x3f)
@@ -119,5 +120,22 @@ func (m Move) String() string {
 	if m.IsPromotion() {
 		promo = string("nbrq"[m.Special()])
 	}
-	return SquareString[m.From()] + SquareString[m.To()] + promo
+	to := m.To()
+	// King starting on e file castles to its destination square as in standard chess
+	if m.IsCastling() && File(m.From()) == FILE_E {
+		if m.Type() == KingCastle {
+			to = (m.From() &^ 7) + FILE_G
+		} else {
+			to = (m.From() &^ 7) + FILE_C
+		}
+	}
+	return SquareString[m.From()] + SquareString[to] + promo
+}
+
+// StringChess960 returns move in UCI_Chess960 notation, where castling is written as king capturing its rook
+func (m Move) StringChess960() string {
+	if m.IsCastling() {
+		return SquareString[m.From()] + SquareString[m.To()]
+	}
+	return m.String()
 }
@@ -45,25 +45,14 @@ func GenerateQuiet(pos *Position, buffer []EvaledMove) (size uint8) {
 	}
 
 	// Castling
-	if pos.SideToMove == White {
-		if allOccupation&WHITE_KING_CASTLE_BLOCK_BB == 0 && pos.Flags&WhiteKingSideCastleFlag == 0 && !pos.IsSquareAttacked(E1, Black) && !pos.IsSquareAttacked(F1, Black) {
-			buffer[size].Move = WhiteKingSideCastle
+	// canCastle inlined
+	castling := pos.castlingRules()
+	for side := KingSide; side <= QueenSide; side++ {
+		if pos.Flags&castlingRightFlags[sideToMove][side] == 0 && allOccupation&castling.block[sideToMove][side] == 0 &&
+			!pos.isCastlingPathAttacked(castling.path[sideToMove][side], sideToMove^1) {
+			buffer[size].Move = castling.moves[sideToMove][side]
 			size++
 		}
-		if allOccupation&WHITE_QUEEN_CASTLE_BLOCK_BB == 0 && pos.Flags&WhiteQueenSideCastleFlag == 0 && !pos.IsSquareAttacked(E1, Black) && !pos.IsSquareAttacked(D1, Black) {
-			buffer[size].Move = WhiteQueenSideCastle
-			size++
-		}
-	} else {
-		if allOccupation&BLACK_KING_CASTLE_BLOCK_BB == 0 && pos.Flags&BlackKingSideCastleFlag == 0 && !pos.IsSquareAttacked(E8, White) && !pos.IsSquareAttacked(F8, White) {
-			buffer[size].Move = BlackKingSideCastle
-			size++
-		}
-		if allOccupation&BLACK_QUEEN_CASTLE_BLOCK_BB == 0 && pos.Flags&BlackQueenSideCastleFlag == 0 && !pos.IsSquareAttacked(E8, White) && !pos.IsSquareAttacked(D8, White) {
-			buffer[size].Move = BlackQueenSideCastle
-			size++
-		}
-
 	}
 
 	// Knights
@@ -1,5 +1,13 @@
 package backend
 
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mhib/combusken/utils"
+)
+
 func Perft(pos *Position, depth int) int {
 	result := 0
 	var child Position
@@ -18,3 +26,132 @@ func Perft(pos *Position, depth int) int {
 
 	return result
 }
+
+type PerftOptions struct {
+	// Number of goroutines root moves are divided between
+	Threads int
+	// Size of perft hash table in megabytes, 0 disables it
+	Hash int
+	// Count legal moves at depth 1 instead of visiting leaves
+	Bulk bool
+}
+
+// PerftResult is number of leaves reached after playing root move
+type PerftResult struct {
+	Move  Move
+	Nodes int
+}
+
+// Divide runs perft separately for every legal root move.
+// Results are sorted by move notation.
+func Divide(pos *Position, depth int, options PerftOptions) []PerftResult {
+	if depth < 1 {
+		return nil
+	}
+	rootMoves := GenerateAllLegalMoves(pos)
+	results := make([]PerftResult, len(rootMoves))
+	var hash *perftHash
+	if options.Hash > 0 {
+		hash = newPerftHash(options.Hash)
+	}
+
+	jobs := make(chan int, len(rootMoves))
+	for idx := range rootMoves {
+		jobs <- idx
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	for i := 0; i < utils.Max(1, options.Threads); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var child Position
+			for idx := range jobs {
+				move := rootMoves[idx].Move
+				pos.MakeLegalMove(move, &child)
+				results[idx] = PerftResult{move, perft(&child, depth-1, options.Bulk, hash)}
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Move.String() < results[j].Move.String()
+	})
+	return results
+}
+
+// PerftNodes returns sum of nodes of all root moves
+func PerftNodes(results []PerftResult) (nodes int) {
+	for _, result := range results {
+		nodes += result.Nodes
+	}
+	return
+}
+
+func perft(pos *Position, depth int, bulk bool, hash *perftHash) int {
+	if depth == 0 {
+		return 1
+	}
+	if hash != nil && depth > 1 {
+		if nodes, ok := hash.get(pos.Key, depth); ok {
+			return nodes
+		}
+	}
+	result := 0
+	var child Position
+	var buffer [256]EvaledMove
+	noisySize := GenerateNoisy(pos, buffer[:])
+	quietsSize := GenerateQuiet(pos, buffer[noisySize:])
+	for _, move := range buffer[:noisySize+quietsSize] {
+		if pos.MakeMove(move.Move, &child) {
+			if bulk && depth == 1 {
+				result++
+			} else {
+				result += perft(&child, depth-1, bulk, hash)
+			}
+		}
+	}
+	if hash != nil && depth > 1 {
+		hash.set(pos.Key, depth, result)
+	}
+	return result
+}
+
+// Divide goroutines share the hash, so both words are accessed atomically.
+// Key is kept xored with data, so key and count written by different goroutines do not form a valid entry.
+type perftEntry struct {
+	key  uint64
+	data uint64
+}
+
+type perftHash struct {
+	entries []perftEntry
+	mask    uint64
+}
+
+func newPerftHash(megabytes int) *perftHash {
+	size := uint64(1)
+	for size*2*16 <= uint64(megabytes)*1024*1024 {
+		size *= 2
+	}
+	return &perftHash{entries: make([]perftEntry, size), mask: size - 1}
+}
+
+// Depth is kept in the lowest byte of data, number of nodes in the rest
+func (h *perftHash) get(key uint64, depth int) (int, bool) {
+	entry := &h.entries[key&h.mask]
+	data := atomic.LoadUint64(&entry.data)
+	if atomic.LoadUint64(&entry.key)^data != key || int(data&0xff) != depth {
+		return 0, false
+	}
+	return int(data >> 8), true
+}
+
+func (h *perftHash) set(key uint64, depth, nodes int) {
+	entry := &h.entries[key&h.mask]
+	data := uint64(nodes)<<8 | uint64(depth)
+	atomic.StoreUint64(&entry.key, key^data)
+	atomic.StoreUint64(&entry.data, data)
+}
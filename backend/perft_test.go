@@ -50,3 +50,59 @@ func TestPerft(t *testing.T) {
 		}
 	}
 }
+
+// https://www.chessprogramming.org/Chess960_Perft_Results
+func TestPerftChess960(t *testing.T) {
+	var tests = []struct {
+		fen   string
+		depth int
+		nodes int
+	}{
+		{
+			fen:   "bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9",
+			depth: 5,
+			nodes: 8146062,
+		},
+		{
+			fen:   "b1q1rrkb/pppppppp/3nn3/8/P7/1PPP4/4PPPP/BQNNRKRB w GE - 1 9",
+			depth: 5,
+			nodes: 6417013,
+		},
+		{
+			fen:   "1nbbnrkr/p1p1ppp1/3p4/1p3P1p/3Pq2P/8/PPP1P1P1/QNBBNRKR w HFhf - 0 9",
+			depth: 4,
+			nodes: 1171749,
+		},
+		{
+			fen:   "qnbnr1kr/ppp1b1pp/4p3/3p1p2/8/2NPP3/PPP1BPPP/QNB1R1KR w HEhe - 1 9",
+			depth: 4,
+			nodes: 824055,
+		},
+	}
+	for i, test := range tests {
+		var p = ParseFen(test.fen)
+		var nodes = Perft(&p, test.depth)
+		if nodes != test.nodes {
+			t.Error(i, test, nodes)
+		}
+	}
+}
+
+func TestDivide(t *testing.T) {
+	var pos = ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq -")
+	var expected = Perft(&pos, 4)
+	for _, options := range []PerftOptions{
+		{Threads: 1},
+		{Threads: 1, Bulk: true},
+		{Threads: 4, Hash: 1, Bulk: true},
+		{Threads: 4, Hash: 1},
+	} {
+		results := Divide(&pos, 4, options)
+		if len(results) != 48 {
+			t.Errorf("%+v: expected 48 root moves, got %d", options, len(results))
+		}
+		if nodes := PerftNodes(results); nodes != expected {
+			t.Errorf("%+v: expected %d nodes, got %d", options, expected, nodes)
+		}
+	}
+}
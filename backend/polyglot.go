@@ -0,0 +1,43 @@
+package backend
+
+const (
+	polyglotCastlingOffset  = 768
+	polyglotEnPassantOffset = 772
+	polyglotTurnOffset      = 780
+)
+
+// PolyglotKey returns hash of position used by Polyglot opening books
+func (pos *Position) PolyglotKey() (key uint64) {
+	for piece := Pawn; piece <= King; piece++ {
+		for colour := Black; colour <= White; colour++ {
+			for fromBB := pos.Pieces[piece] & pos.Colours[colour]; fromBB != 0; fromBB &= (fromBB - 1) {
+				key ^= polyglotRandom[64*(2*piece+colour)+BitScan(fromBB)]
+			}
+		}
+	}
+
+	for idx, flag := range [...]uint8{WhiteKingSideCastleFlag, WhiteQueenSideCastleFlag, BlackKingSideCastleFlag, BlackQueenSideCastleFlag} {
+		if pos.Flags&flag == 0 {
+			key ^= polyglotRandom[polyglotCastlingOffset+idx]
+		}
+	}
+
+	// En passant file is hashed only if capture is possible
+	if pos.EpSquare != 0 {
+		var adjacent uint64
+		if File(pos.EpSquare) != FILE_A {
+			adjacent |= SquareMask[pos.EpSquare-1]
+		}
+		if File(pos.EpSquare) != FILE_H {
+			adjacent |= SquareMask[pos.EpSquare+1]
+		}
+		if adjacent&pos.Pieces[Pawn]&pos.Colours[pos.SideToMove] != 0 {
+			key ^= polyglotRandom[polyglotEnPassantOffset+File(pos.EpSquare)]
+		}
+	}
+
+	if pos.SideToMove == White {
+		key ^= polyglotRandom[polyglotTurnOffset]
+	}
+	return
+}
@@ -35,22 +35,16 @@ type Position struct {
 	SideToMove int
 	EpSquare   int
 	FiftyMove  int
+	FullMove   int
 	LastMove   Move
 	Flags      uint8
+	castling   *castlingInfo
 }
 
 var InitialPosition Position = ParseFen(InitialPositionFen)
 
-var castleFlags [64]uint8
-
 func init() {
 	HashPosition(&InitialPosition)
-	castleFlags[A1] = WhiteQueenSideCastleFlag
-	castleFlags[H1] = WhiteKingSideCastleFlag
-	castleFlags[E1] = WhiteQueenSideCastleFlag | WhiteKingSideCastleFlag
-	castleFlags[H8] = BlackKingSideCastleFlag
-	castleFlags[A8] = BlackQueenSideCastleFlag
-	castleFlags[E8] = BlackQueenSideCastleFlag | BlackKingSideCastleFlag
 }
 
 func (pos *Position) TypeOnSquare(squareBB uint64) int {
@@ -75,7 +69,6 @@ func (p *Position) MovePiece(piece, side, from, to int) {
 	p.Colours[side] ^= b
 	p.Pieces[piece] ^= b
 	p.Key ^= zobrist[piece][side][from] ^ zobrist[piece][side][to]
-	p.Flags |= castleFlags[from] | castleFlags[to]
 	if piece == King || piece == Pawn {
 		p.PawnKey ^= zobrist[piece][side][from] ^ zobrist[piece][side][to]
 	}
@@ -86,7 +79,6 @@ func (p *Position) TogglePiece(piece, side, square int) {
 	p.Colours[side] ^= b
 	p.Pieces[piece] ^= b
 	p.Key ^= zobrist[piece][side][square]
-	p.Flags |= castleFlags[square]
 	if piece == Pawn {
 		p.PawnKey ^= zobrist[Pawn][side][square]
 	}
@@ -103,10 +95,12 @@ func (pos *Position) MakeNullMove(res *Position) {
 	res.Pieces[King] = pos.Pieces[King]
 	res.SideToMove = pos.SideToMove ^ 1
 	res.Flags = pos.Flags
+	res.castling = pos.castling
 	res.Key = pos.Key ^ zobristColor ^ zobristEpSquare[pos.EpSquare]
 	res.PawnKey = pos.PawnKey ^ zobristColor
 
 	res.FiftyMove = pos.FiftyMove + 1
+	res.FullMove = pos.FullMove + (pos.SideToMove ^ 1)
 	res.LastMove = NullMove
 	res.EpSquare = 0
 }
@@ -121,7 +115,10 @@ func (pos *Position) MakeMove(move Move, res *Position) bool {
 	res.Pieces[Queen] = pos.Pieces[Queen]
 	res.Pieces[King] = pos.Pieces[King]
 	res.SideToMove = pos.SideToMove
-	res.Flags = pos.Flags
+	// Castling rights are lost when piece moves from or to castling square
+	castling := pos.castlingRules()
+	res.Flags = pos.Flags | castling.flags[move.From()] | castling.flags[move.To()]
+	res.castling = castling
 	res.Key = pos.Key ^ zobristColor ^ zobristEpSquare[pos.EpSquare] ^ zobristFlags[pos.Flags]
 	res.PawnKey = pos.PawnKey ^ zobristColor
 
@@ -130,31 +127,27 @@ func (pos *Position) MakeMove(move Move, res *Position) bool {
 	} else {
 		res.FiftyMove = pos.FiftyMove + 1
 	}
+	// Full move number is incremented after Black's move
+	res.FullMove = pos.FullMove + (pos.SideToMove ^ 1)
 
 	res.EpSquare = 0
 
 	if !move.IsPromotion() {
-		res.MovePiece(move.MovedPiece(), pos.SideToMove, move.From(), move.To())
 		switch move.Type() {
+		case QuietMove:
+			res.MovePiece(move.MovedPiece(), pos.SideToMove, move.From(), move.To())
 		case DoublePawnPush:
+			res.MovePiece(Pawn, pos.SideToMove, move.From(), move.To())
 			res.EpSquare = move.To()
 			res.Key ^= zobristEpSquare[move.To()]
 		case Capture:
+			res.MovePiece(move.MovedPiece(), pos.SideToMove, move.From(), move.To())
 			res.TogglePiece(move.CapturedPiece(), pos.SideToMove^1, move.To())
-		case KingCastle:
-			if pos.SideToMove == White {
-				res.MovePiece(Rook, White, H1, F1)
-			} else {
-				res.MovePiece(Rook, Black, H8, F8)
-			}
-		case QueenCastle:
-			if pos.SideToMove == White {
-				res.MovePiece(Rook, White, A1, D1)
-			} else {
-				res.MovePiece(Rook, Black, A8, D8)
-			}
 		case EPCapture:
+			res.MovePiece(Pawn, pos.SideToMove, move.From(), move.To())
 			res.TogglePiece(Pawn, pos.SideToMove^1, pos.EpSquare)
+		default:
+			res.castle(move, pos.SideToMove)
 		}
 	} else {
 		res.TogglePiece(Pawn, pos.SideToMove, move.From())
@@ -212,7 +205,7 @@ func (p *Position) MakeMoveLAN(lan string) (Position, bool) {
 	quietsSize := GenerateQuiet(p, buffer[noisySize:])
 	for i := range buffer[:noisySize+quietsSize] {
 		var mv = buffer[i].Move
-		if strings.EqualFold(mv.String(), lan) {
+		if strings.EqualFold(mv.String(), lan) || (mv.IsCastling() && strings.EqualFold(mv.StringChess960(), lan)) {
 			var newPosition = Position{}
 			if p.MakeMove(mv, &newPosition) {
 				return newPosition, true
@@ -234,7 +227,10 @@ func (pos *Position) MakeLegalMove(move Move, res *Position) {
 	res.Pieces[Queen] = pos.Pieces[Queen]
 	res.Pieces[King] = pos.Pieces[King]
 	res.SideToMove = pos.SideToMove
-	res.Flags = pos.Flags
+	// Castling rights are lost when piece moves from or to castling square
+	castling := pos.castlingRules()
+	res.Flags = pos.Flags | castling.flags[move.From()] | castling.flags[move.To()]
+	res.castling = castling
 	res.Key = pos.Key ^ zobristColor ^ zobristEpSquare[pos.EpSquare] ^ zobristFlags[pos.Flags]
 	res.PawnKey = pos.PawnKey ^ zobristColor
 
@@ -243,31 +239,27 @@ func (pos *Position) MakeLegalMove(move Move, res *Position) {
 	} else {
 		res.FiftyMove = pos.FiftyMove + 1
 	}
+	// Full move number is incremented after Black's move
+	res.FullMove = pos.FullMove + (pos.SideToMove ^ 1)
 
 	res.EpSquare = 0
 
 	if !move.IsPromotion() {
-		res.MovePiece(move.MovedPiece(), pos.SideToMove, move.From(), move.To())
 		switch move.Type() {
+		case QuietMove:
+			res.MovePiece(move.MovedPiece(), pos.SideToMove, move.From(), move.To())
 		case DoublePawnPush:
+			res.MovePiece(Pawn, pos.SideToMove, move.From(), move.To())
 			res.EpSquare = move.To()
 			res.Key ^= zobristEpSquare[move.To()]
 		case Capture:
+			res.MovePiece(move.MovedPiece(), pos.SideToMove, move.From(), move.To())
 			res.TogglePiece(move.CapturedPiece(), pos.SideToMove^1, move.To())
-		case KingCastle:
-			if pos.SideToMove == White {
-				res.MovePiece(Rook, White, H1, F1)
-			} else {
-				res.MovePiece(Rook, Black, H8, F8)
-			}
-		case QueenCastle:
-			if pos.SideToMove == White {
-				res.MovePiece(Rook, White, A1, D1)
-			} else {
-				res.MovePiece(Rook, Black, A8, D8)
-			}
 		case EPCapture:
+			res.MovePiece(Pawn, pos.SideToMove, move.From(), move.To())
 			res.TogglePiece(Pawn, pos.SideToMove^1, pos.EpSquare)
+		default:
+			res.castle(move, pos.SideToMove)
 		}
 	} else {
 		res.TogglePiece(Pawn, pos.SideToMove, move.From())
@@ -345,23 +337,9 @@ func (pos *Position) IsMovePseudoLegal(move Move) bool {
 		if move.IsNormal() {
 			return (KingAttacks[move.From()] & ^we)&toMask != 0
 		}
-		if pos.SideToMove == White {
-			if move == WhiteKingSideCastle {
-				return occupancy&WHITE_KING_CASTLE_BLOCK_BB == 0 && pos.Flags&WhiteKingSideCastleFlag == 0 && !pos.IsSquareAttacked(E1, Black) && !pos.IsSquareAttacked(F1, Black)
-			} else if move == WhiteQueenSideCastle {
-				return occupancy&WHITE_QUEEN_CASTLE_BLOCK_BB == 0 && pos.Flags&WhiteQueenSideCastleFlag == 0 && !pos.IsSquareAttacked(E1, Black) && !pos.IsSquareAttacked(D1, Black)
-			} else {
-				return false
-			}
-		} else {
-			if move == BlackKingSideCastle {
-				return occupancy&BLACK_KING_CASTLE_BLOCK_BB == 0 && pos.Flags&BlackKingSideCastleFlag == 0 && !pos.IsSquareAttacked(E8, White) && !pos.IsSquareAttacked(F8, White)
-			} else if move == BlackQueenSideCastleFlag {
-				return occupancy&BLACK_QUEEN_CASTLE_BLOCK_BB == 0 && pos.Flags&BlackQueenSideCastleFlag == 0 && !pos.IsSquareAttacked(E8, White) && !pos.IsSquareAttacked(D8, White)
-			} else {
-				return false
-			}
-		}
+		side := castlingSide(move)
+		castling := pos.castlingRules()
+		return move == castling.moves[pos.SideToMove][side] && pos.canCastle(castling, side)
 	}
 
 	return false
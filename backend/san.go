@@ -0,0 +1,153 @@
+package backend
+
+import "strings"
+
+const sanPieceNames = "PNBRQK"
+
+// ToSAN returns move in Standard Algebraic Notation.
+// Move is expected to be legal in position.
+func (pos *Position) ToSAN(move Move) string {
+	san := pos.sanWithoutSuffix(move, GenerateAllLegalMoves(pos))
+	var child Position
+	pos.MakeLegalMove(move, &child)
+	if child.IsInCheck() {
+		if len(GenerateAllLegalMoves(&child)) == 0 {
+			return san + "#"
+		}
+		return san + "+"
+	}
+	return san
+}
+
+// MovesToSAN converts sequence of moves played from position, e.g. principal variation, to SAN
+func (pos *Position) MovesToSAN(moves []Move) []string {
+	res := make([]string, 0, len(moves))
+	current := *pos
+	var child Position
+	for _, move := range moves {
+		res = append(res, current.ToSAN(move))
+		current.MakeLegalMove(move, &child)
+		current = child
+	}
+	return res
+}
+
+// ParseMoveSAN finds legal move described by SAN.
+// Check, mate and annotation suffixes are ignored.
+// Disambiguation longer than needed, e.g. "Ngf3" or "Qd1d4", is accepted.
+func (pos *Position) ParseMoveSAN(san string) (Move, bool) {
+	san = normalizeSAN(san)
+	if san == "" {
+		return NullMove, false
+	}
+	legalMoves := GenerateAllLegalMoves(pos)
+	for _, move := range legalMoves {
+		if normalizeSAN(pos.sanWithoutSuffix(move.Move, legalMoves)) == san {
+			return move.Move, true
+		}
+	}
+	for _, move := range legalMoves {
+		if move.MovedPiece() == Pawn || move.Type() == KingCastle || move.Type() == QueenCastle {
+			continue
+		}
+		for _, extended := range extendedDisambiguations(move.Move, legalMoves) {
+			if normalizeSAN(sanWithDisambiguation(move.Move, extended)) == san {
+				return move.Move, true
+			}
+		}
+	}
+	return NullMove, false
+}
+
+// MakeMoveSAN returns position after move described by SAN
+func (pos *Position) MakeMoveSAN(san string) (Position, bool) {
+	move, ok := pos.ParseMoveSAN(san)
+	if !ok {
+		return Position{}, false
+	}
+	var res Position
+	pos.MakeLegalMove(move, &res)
+	return res, true
+}
+
+func normalizeSAN(san string) string {
+	if index := strings.IndexAny(san, "+#?!"); index >= 0 {
+		san = san[:index]
+	}
+	san = strings.Replace(san, "0", "O", -1)
+	san = strings.Replace(san, "=", "", -1)
+	return san
+}
+
+func (pos *Position) sanWithoutSuffix(move Move, legalMoves []EvaledMove) string {
+	if move.Type() == KingCastle {
+		return "O-O"
+	}
+	if move.Type() == QueenCastle {
+		return "O-O-O"
+	}
+	var sb strings.Builder
+	if move.MovedPiece() == Pawn {
+		if move.IsCapture() {
+			sb.WriteByte(SquareString[move.From()][0])
+		}
+		writeSANDestination(&sb, move)
+		return sb.String()
+	}
+	return sanWithDisambiguation(move, disambiguation(move, legalMoves))
+}
+
+func sanWithDisambiguation(move Move, disambiguation string) string {
+	var sb strings.Builder
+	sb.WriteByte(sanPieceNames[move.MovedPiece()])
+	sb.WriteString(disambiguation)
+	writeSANDestination(&sb, move)
+	return sb.String()
+}
+
+func writeSANDestination(sb *strings.Builder, move Move) {
+	if move.IsCapture() {
+		sb.WriteByte('x')
+	}
+	sb.WriteString(SquareString[move.To()])
+	if move.IsPromotion() {
+		sb.WriteByte('=')
+		sb.WriteByte(sanPieceNames[move.PromotedPiece()])
+	}
+}
+
+// File is preferred to rank, both are used only when neither is unique
+func disambiguation(move Move, legalMoves []EvaledMove) string {
+	ambiguous, sameFile, sameRank := false, false, false
+	for _, other := range legalMoves {
+		if other.From() == move.From() || other.To() != move.To() || other.MovedPiece() != move.MovedPiece() {
+			continue
+		}
+		ambiguous = true
+		sameFile = sameFile || File(other.From()) == File(move.From())
+		sameRank = sameRank || Rank(other.From()) == Rank(move.From())
+	}
+	switch {
+	case !ambiguous:
+		return ""
+	case !sameFile:
+		return SquareString[move.From()][:1]
+	case !sameRank:
+		return SquareString[move.From()][1:]
+	default:
+		return SquareString[move.From()]
+	}
+}
+
+// Disambiguations that contain the required one, but are longer
+func extendedDisambiguations(move Move, legalMoves []EvaledMove) []string {
+	square := SquareString[move.From()]
+	switch disambiguation(move, legalMoves) {
+	case "":
+		return []string{square[:1], square[1:], square}
+	case square:
+		return nil
+	default:
+		return []string{square}
+	}
+}
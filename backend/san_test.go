@@ -0,0 +1,101 @@
+package backend
+
+import "testing"
+
+func TestSAN(t *testing.T) {
+	var tests = []struct {
+		fen string
+		lan string
+		san string
+	}{
+		{InitialPositionFen, "g1f3", "Nf3"},
+		{InitialPositionFen, "e2e4", "e4"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "e1g1", "O-O"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1", "e8c8", "O-O-O"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "d5e6", "dxe6"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "e5f7", "Nxf7"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "c3b1", "Nb1"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "d2c1", "Bc1"},
+		{"2k5/8/8/8/8/8/4K3/R6R w - - 0 1", "a1d1", "Rad1"},
+		{"4k3/8/8/R7/8/8/8/R3K3 w Q - 0 1", "a1a3", "R1a3"},
+		{"4k3/8/8/8/8/Q1Q5/8/Q3K3 w - - 0 1", "a3b2", "Qa3b2"},
+		{"8/5P2/8/8/8/8/k7/4K3 w - - 0 1", "f7f8q", "f8=Q"},
+		{"6n1/5P2/8/8/8/8/k7/4K3 w - - 0 1", "f7g8n", "fxg8=N"},
+		{"rnbqkbnr/ppp2ppp/8/3pP3/8/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 3", "e5d6", "exd6"},
+		{"4k3/8/8/8/8/8/8/R3K3 w Q - 0 1", "a1a8", "Ra8+"},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "a1a8", "Ra8#"},
+	}
+	for _, test := range tests {
+		pos := ParseFen(test.fen)
+		newPos, ok := pos.MakeMoveLAN(test.lan)
+		if !ok {
+			t.Fatalf("%v: illegal move %v", test.fen, test.lan)
+		}
+		move := newPos.LastMove
+		if san := pos.ToSAN(move); san != test.san {
+			t.Errorf("%v: expected %v, got %v", test.fen, test.san, san)
+		}
+		if parsed, ok := pos.ParseMoveSAN(test.san); !ok || parsed != move {
+			t.Errorf("%v: could not parse %v", test.fen, test.san)
+		}
+	}
+}
+
+func TestParseMoveSANVariants(t *testing.T) {
+	pos := ParseFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	for _, san := range []string{"0-0", "O-O!", "Nxf7?!", "Qxf6+"} {
+		if _, ok := pos.ParseMoveSAN(san); !ok {
+			t.Errorf("could not parse %v", san)
+		}
+	}
+	for _, san := range []string{"", "Ng1", "Bh7", "Ke3", "e8=Q"} {
+		if _, ok := pos.ParseMoveSAN(san); ok {
+			t.Errorf("parsed invalid move %v", san)
+		}
+	}
+}
+
+func TestParseMoveSANOverDisambiguated(t *testing.T) {
+	for _, tt := range []struct {
+		fen  string
+		san  string
+		move string
+	}{
+		{InitialPositionFen, "Ngf3", "g1f3"},
+		{InitialPositionFen, "N1f3", "g1f3"},
+		{InitialPositionFen, "Ng1f3", "g1f3"},
+		{"4k3/8/8/8/8/8/8/3QK3 w - - 0 1", "Qd1d4+", "d1d4"},
+		{"4k3/8/8/8/8/8/4K3/R6R w - - 0 1", "Ra1d1", "a1d1"},
+	} {
+		pos := ParseFen(tt.fen)
+		move, ok := pos.ParseMoveSAN(tt.san)
+		if !ok || move.String() != tt.move {
+			t.Errorf("%v: expected %v, got %v", tt.san, tt.move, move.String())
+		}
+	}
+	pos := ParseFen("4k3/8/8/8/8/8/4K3/R6R w - - 0 1")
+	for _, san := range []string{"Rd1", "R1d1", "Rbd1", "Ra2d1"} {
+		if _, ok := pos.ParseMoveSAN(san); ok {
+			t.Errorf("parsed invalid move %v", san)
+		}
+	}
+	if _, ok := InitialPosition.ParseMoveSAN("Nbf3"); ok {
+		t.Error("parsed move with wrong disambiguation")
+	}
+}
+
+func TestMovesToSAN(t *testing.T) {
+	pos := InitialPosition
+	var moves []Move
+	current := pos
+	for _, lan := range []string{"e2e4", "e7e5", "g1f3", "b8c6", "f1b5"} {
+		current, _ = current.MakeMoveLAN(lan)
+		moves = append(moves, current.LastMove)
+	}
+	expected := []string{"e4", "e5", "Nf3", "Nc6", "Bb5"}
+	for i, san := range pos.MovesToSAN(moves) {
+		if san != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], san)
+		}
+	}
+}
@@ -4,13 +4,16 @@ import (
 	"math/rand"
 )
 
+// Seed of random generator used to create hash keys
+const ZobristSeed = 0
+
 var zobrist [6][2][64]uint64
 var zobristEpSquare [64]uint64
 var zobristFlags [16]uint64
 var zobristColor uint64
 
 func initZobrist() {
-	var r = rand.New(rand.NewSource(0))
+	var r = rand.New(rand.NewSource(ZobristSeed))
 	for y := Pawn; y <= King; y++ {
 		for x := Black; x <= White; x++ {
 			for z := A1; z <= H8; z++ {
@@ -0,0 +1,145 @@
+// Package book reads and builds opening books in Polyglot format
+package book
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sort"
+
+	"github.com/mhib/combusken/backend"
+)
+
+// Size of a single entry in Polyglot file
+const EntrySize = 16
+
+// Entry is a single book move, entries of the same position share the key
+type Entry struct {
+	Key    uint64
+	Move   uint16
+	Weight uint16
+	Learn  uint32
+}
+
+type Book struct {
+	entries []Entry
+}
+
+// Load reads the whole book file into memory
+func Load(path string) (*Book, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+func Read(r io.Reader) (*Book, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%EntrySize != 0 {
+		return nil, errors.New("book: file size is not a multiple of entry size")
+	}
+	entries := make([]Entry, len(data)/EntrySize)
+	for i := range entries {
+		chunk := data[i*EntrySize : (i+1)*EntrySize]
+		entries[i] = Entry{
+			Key:    binary.BigEndian.Uint64(chunk),
+			Move:   binary.BigEndian.Uint16(chunk[8:]),
+			Weight: binary.BigEndian.Uint16(chunk[10:]),
+			Learn:  binary.BigEndian.Uint32(chunk[12:]),
+		}
+	}
+	// Entries are expected to be sorted, but binary search must not fail on unsorted files
+	if !sort.SliceIsSorted(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key }) {
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	}
+	return &Book{entries: entries}, nil
+}
+
+// Size returns number of entries in book
+func (b *Book) Size() int {
+	return len(b.entries)
+}
+
+// Entries returns all entries of position
+func (b *Book) Entries(pos *backend.Position) []Entry {
+	key := pos.PolyglotKey()
+	start := sort.Search(len(b.entries), func(i int) bool { return b.entries[i].Key >= key })
+	end := start
+	for end < len(b.entries) && b.entries[end].Key == key {
+		end++
+	}
+	return b.entries[start:end]
+}
+
+// PickMove chooses one of legal book moves with probability proportional to its weight.
+// Moves with zero weight are never played.
+func (b *Book) PickMove(pos *backend.Position, random *rand.Rand) (backend.Move, bool) {
+	var moves []backend.Move
+	var weights []int
+	sum := 0
+	for _, entry := range b.Entries(pos) {
+		move := DecodeMove(pos, entry.Move)
+		if move == backend.NullMove || entry.Weight == 0 {
+			continue
+		}
+		moves = append(moves, move)
+		weights = append(weights, int(entry.Weight))
+		sum += int(entry.Weight)
+	}
+	if sum == 0 {
+		return backend.NullMove, false
+	}
+	pick := random.Intn(sum)
+	for i, weight := range weights {
+		if pick < weight {
+			return moves[i], true
+		}
+		pick -= weight
+	}
+	return backend.NullMove, false
+}
+
+// EncodeMove converts move to Polyglot format.
+// Castling is encoded as king capturing its rook, the same way as in backend.
+func EncodeMove(move backend.Move) uint16 {
+	res := uint16(move.To()) | uint16(move.From())<<6
+	if move.IsPromotion() {
+		res |= uint16(move.PromotedPiece()-backend.Knight+1) << 12
+	}
+	return res
+}
+
+// DecodeMove finds legal move encoded in Polyglot format, returns NullMove if there is none
+func DecodeMove(pos *backend.Position, move uint16) backend.Move {
+	for _, legalMove := range backend.GenerateAllLegalMoves(pos) {
+		if EncodeMove(legalMove.Move) == move {
+			return legalMove.Move
+		}
+	}
+	return backend.NullMove
+}
+
+// Write writes entries in Polyglot format, entries are expected to be sorted by key
+func Write(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	var chunk [EntrySize]byte
+	for _, entry := range entries {
+		binary.BigEndian.PutUint64(chunk[:], entry.Key)
+		binary.BigEndian.PutUint16(chunk[8:], entry.Move)
+		binary.BigEndian.PutUint16(chunk[10:], entry.Weight)
+		binary.BigEndian.PutUint32(chunk[12:], entry.Learn)
+		if _, err := bw.Write(chunk[:]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,178 @@
+package book
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/mhib/combusken/backend"
+	"github.com/mhib/combusken/pgn"
+)
+
+func encodeEntries(entries []Entry) []byte {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		binary.Write(&buf, binary.BigEndian, entry)
+	}
+	return buf.Bytes()
+}
+
+func lanMove(t *testing.T, pos *backend.Position, lan string) backend.Move {
+	for _, move := range backend.GenerateAllLegalMoves(pos) {
+		if move.String() == lan {
+			return move.Move
+		}
+	}
+	t.Fatalf("illegal move %v", lan)
+	return backend.NullMove
+}
+
+func TestPickMove(t *testing.T) {
+	pos := backend.InitialPosition
+	key := pos.PolyglotKey()
+	e4 := lanMove(t, &pos, "e2e4")
+	d4 := lanMove(t, &pos, "d2d4")
+	nf3 := lanMove(t, &pos, "g1f3")
+	data := encodeEntries([]Entry{
+		{Key: key - 1, Move: EncodeMove(nf3), Weight: 100},
+		{Key: key, Move: EncodeMove(e4), Weight: 3},
+		{Key: key, Move: EncodeMove(d4), Weight: 1},
+		{Key: key, Move: EncodeMove(nf3), Weight: 0},
+		// e2e5 is illegal
+		{Key: key, Move: 12<<6 | 36, Weight: 100},
+		{Key: key + 1, Move: EncodeMove(nf3), Weight: 100},
+	})
+	book, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(book.Entries(&pos)) != 4 {
+		t.Errorf("expected 4 entries, got %d", len(book.Entries(&pos)))
+	}
+
+	counts := make(map[backend.Move]int)
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 4000; i++ {
+		move, ok := book.PickMove(&pos, random)
+		if !ok {
+			t.Fatal("expected book move")
+		}
+		counts[move]++
+	}
+	if len(counts) != 2 || counts[e4] < 2700 || counts[d4] < 800 {
+		t.Errorf("unexpected distribution of book moves %v", counts)
+	}
+
+	afterE4, _ := pos.MakeMoveLAN("e2e4")
+	if _, ok := book.PickMove(&afterE4, random); ok {
+		t.Error("expected no book move")
+	}
+}
+
+func TestReadInvalidSize(t *testing.T) {
+	if _, err := Read(bytes.NewReader(make([]byte, EntrySize+1))); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestEncodeMove(t *testing.T) {
+	pos := backend.ParseFen("r3k2r/1P6/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	for _, lan := range []string{"e1g1", "e1c1", "b7a8q", "b7b8n"} {
+		move := lanMove(t, &pos, lan)
+		if decoded := DecodeMove(&pos, EncodeMove(move)); decoded != move {
+			t.Errorf("%v: expected %v, got %v", lan, move, decoded)
+		}
+	}
+	// Polyglot encodes castling as king capturing rook
+	if encoded := EncodeMove(lanMove(t, &pos, "e1g1")); encoded != 4<<6|7 {
+		t.Errorf("unexpected castling encoding %d", encoded)
+	}
+}
+
+const builderGames = `[WhiteElo "2500"]
+[BlackElo "2400"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 1-0
+
+[Result "1/2-1/2"]
+
+1. d4 d5 1/2-1/2
+
+[WhiteElo "2600"]
+[BlackElo "2600"]
+[Result "0-1"]
+
+1. e4 c5 2. Qh5 0-1
+
+[Result "*"]
+
+1. c4 *
+`
+
+func TestBuilder(t *testing.T) {
+	var tests = []struct {
+		options BuilderOptions
+		used    int
+		// Weights of moves in initial position
+		weights map[string]uint16
+	}{
+		{BuilderOptions{MaxPly: 40, Results: []string{pgn.WhiteWins, pgn.BlackWins, pgn.Draw}}, 3, map[string]uint16{"e2e4": 2, "d2d4": 1}},
+		{BuilderOptions{MaxPly: 40, Results: []string{pgn.WhiteWins, pgn.BlackWins, pgn.Draw}, MinGames: 2}, 3, map[string]uint16{"e2e4": 2}},
+		{BuilderOptions{MaxPly: 40, Results: []string{pgn.WhiteWins, pgn.BlackWins, pgn.Draw}, MinElo: 2450}, 1, map[string]uint16{}},
+		{BuilderOptions{MaxPly: 40, Results: []string{pgn.Draw, pgn.Unknown}}, 2, map[string]uint16{"d2d4": 1}},
+		{BuilderOptions{MaxPly: 0, Results: []string{pgn.WhiteWins}}, 1, map[string]uint16{}},
+	}
+	for i, test := range tests {
+		builder := NewBuilder(test.options)
+		reader := pgn.NewReader(strings.NewReader(builderGames))
+		used := 0
+		for {
+			game, err := reader.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if builder.AddGame(game) {
+				used++
+			}
+		}
+		if used != test.used {
+			t.Errorf("%d: expected %d used games, got %d", i, test.used, used)
+		}
+
+		var buf bytes.Buffer
+		if err := Write(&buf, builder.Entries()); err != nil {
+			t.Fatal(err)
+		}
+		book, err := Read(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pos := backend.InitialPosition
+		weights := make(map[string]uint16)
+		for _, entry := range book.Entries(&pos) {
+			weights[DecodeMove(&pos, entry.Move).String()] = entry.Weight
+		}
+		if len(weights) != len(test.weights) {
+			t.Errorf("%d: expected %v, got %v", i, test.weights, weights)
+		}
+		for move, weight := range test.weights {
+			if weights[move] != weight {
+				t.Errorf("%d: expected %v, got %v", i, test.weights, weights)
+			}
+		}
+	}
+}
+
+func TestAddGamesReadError(t *testing.T) {
+	builder := NewBuilder(BuilderOptions{MaxPly: 40, Results: []string{pgn.WhiteWins}})
+	// Reading directory fails on every call, so it must not be skipped like malformed game
+	if err := addGames(builder, t.TempDir()); err == nil {
+		t.Errorf("expected error for unreadable file")
+	}
+}
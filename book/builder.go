@@ -0,0 +1,148 @@
+package book
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/mhib/combusken/backend"
+	"github.com/mhib/combusken/pgn"
+)
+
+type BuilderOptions struct {
+	// Moves played after this ply are not added
+	MaxPly int
+	// Games in which either player has lower or unknown Elo are skipped, 0 disables the filter
+	MinElo int
+	// Moves played in fewer games are not written
+	MinGames int
+	// Only games with these results are used
+	Results []string
+}
+
+type moveStats struct {
+	games int
+	// 2 points for win, 1 for draw, 0 for loss from perspective of side that made the move
+	score int
+}
+
+// Builder accumulates statistics of moves played in games
+type Builder struct {
+	options   BuilderOptions
+	positions map[uint64]map[uint16]*moveStats
+}
+
+func NewBuilder(options BuilderOptions) *Builder {
+	return &Builder{options: options, positions: make(map[uint64]map[uint16]*moveStats)}
+}
+
+// AddGame adds main line moves of game, returns false if game was filtered out
+func (b *Builder) AddGame(game *pgn.Game) bool {
+	if !b.acceptsResult(game.Result) || !b.acceptsElo(game) {
+		return false
+	}
+	pos := game.Start
+	var child backend.Position
+	for ply, node := range game.Moves {
+		if ply >= b.options.MaxPly {
+			break
+		}
+		key := pos.PolyglotKey()
+		moves, ok := b.positions[key]
+		if !ok {
+			moves = make(map[uint16]*moveStats)
+			b.positions[key] = moves
+		}
+		encoded := EncodeMove(node.Move)
+		stats, ok := moves[encoded]
+		if !ok {
+			stats = &moveStats{}
+			moves[encoded] = stats
+		}
+		stats.games++
+		stats.score += resultScore(game.Result, pos.SideToMove)
+
+		pos.MakeLegalMove(node.Move, &child)
+		pos = child
+	}
+	return true
+}
+
+func (b *Builder) acceptsResult(result string) bool {
+	for _, accepted := range b.options.Results {
+		if accepted == result {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Builder) acceptsElo(game *pgn.Game) bool {
+	if b.options.MinElo <= 0 {
+		return true
+	}
+	for _, tag := range [...]string{"WhiteElo", "BlackElo"} {
+		elo, err := strconv.Atoi(game.Tag(tag))
+		if err != nil || elo < b.options.MinElo {
+			return false
+		}
+	}
+	return true
+}
+
+func resultScore(result string, sideToMove int) int {
+	switch {
+	case result == pgn.Draw:
+		return 1
+	case result == pgn.WhiteWins && sideToMove == backend.White,
+		result == pgn.BlackWins && sideToMove == backend.Black:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// Positions returns number of distinct positions added so far
+func (b *Builder) Positions() int {
+	return len(b.positions)
+}
+
+// Entries returns book entries sorted by key and descending weight.
+// Moves that never scored are skipped, weights are scaled down to fit in 16 bits.
+func (b *Builder) Entries() []Entry {
+	var entries []Entry
+	maxScore := 0
+	for key, moves := range b.positions {
+		for move, stats := range moves {
+			if stats.games < b.options.MinGames || stats.score == 0 {
+				continue
+			}
+			if stats.score > maxScore {
+				maxScore = stats.score
+			}
+			// Weight is temporarily kept in Learn field, as it can overflow uint16
+			entries = append(entries, Entry{Key: key, Move: move, Learn: uint32(stats.score)})
+		}
+	}
+	scale := 1.0
+	if maxScore > math.MaxUint16 {
+		scale = float64(math.MaxUint16) / float64(maxScore)
+	}
+	for i := range entries {
+		weight := uint16(float64(entries[i].Learn) * scale)
+		if weight == 0 {
+			weight = 1
+		}
+		entries[i].Weight, entries[i].Learn = weight, 0
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Key != entries[j].Key {
+			return entries[i].Key < entries[j].Key
+		}
+		if entries[i].Weight != entries[j].Weight {
+			return entries[i].Weight > entries[j].Weight
+		}
+		return entries[i].Move < entries[j].Move
+	})
+	return entries
+}
@@ -0,0 +1,95 @@
+package book
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mhib/combusken/pgn"
+)
+
+const makeBookUsage = "usage: combusken makebook [-max-ply n] [-min-elo n] [-min-games n] [-results list] -o book.bin games.pgn..."
+
+// MakeBook builds Polyglot book from PGN files given in command line arguments following "makebook".
+// Book file is complete only if no error is returned.
+func MakeBook(args []string) error {
+	flags := flag.NewFlagSet("makebook", flag.ExitOnError)
+	output := flags.String("o", "book.bin", "output file")
+	maxPly := flags.Int("max-ply", 40, "moves played after this ply are not added")
+	minElo := flags.Int("min-elo", 0, "skip games in which either player has lower or unknown Elo")
+	minGames := flags.Int("min-games", 1, "skip moves played in fewer games")
+	results := flags.String("results", strings.Join([]string{pgn.WhiteWins, pgn.BlackWins, pgn.Draw}, ","), "comma separated results of used games")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, makeBookUsage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("no PGN files given")
+	}
+
+	builder := NewBuilder(BuilderOptions{
+		MaxPly:   *maxPly,
+		MinElo:   *minElo,
+		MinGames: *minGames,
+		Results:  strings.Split(*results, ","),
+	})
+	for _, path := range flags.Args() {
+		if err := addGames(builder, path); err != nil {
+			return err
+		}
+	}
+
+	entries := builder.Entries()
+	if err := writeBook(*output, entries); err != nil {
+		return err
+	}
+	fmt.Printf("Positions: %d\nEntries: %d\n", builder.Positions(), len(entries))
+	return nil
+}
+
+// Error of Close is returned as well, as it can be the first one to report failed write
+func writeBook(path string, entries []Entry) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = Write(file, entries); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Malformed games are reported and skipped, errors of reading file stop building
+func addGames(builder *Builder, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := pgn.NewReader(file)
+	read, used := 0, 0
+	for {
+		game, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if _, ok := err.(*pgn.ParseError); ok {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		read++
+		if builder.AddGame(game) {
+			used++
+		}
+	}
+	fmt.Printf("%s: %d games read, %d used\n", path, read, used)
+	return nil
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
+	"github.com/mhib/combusken/book"
 	"github.com/mhib/combusken/engine"
 	"github.com/mhib/combusken/tuning"
 	"github.com/mhib/combusken/uci"
@@ -15,8 +17,17 @@ func main() {
 			tuning.Tune()
 		case "trace-tune":
 			tuning.TraceTune()
+		case "fit-wdl":
+			tuning.FitWDL()
 		case "bench":
 			engine.Benchmark()
+		case "perft":
+			uci.Perft(os.Args[2:])
+		case "makebook":
+			if err := book.MakeBook(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
 		}
 		return
 	}
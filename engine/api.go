@@ -0,0 +1,260 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mhib/combusken/backend"
+)
+
+// Number of search updates buffered for reader of AsyncSearch.Info
+const infoBufferSize = 64
+
+var errSearchRunning = errors.New("search is already running")
+
+// New creates engine with options given by their UCI names, e.g. {"Hash": "64", "Threads": "2"},
+// and prepares it for a new game from the initial position.
+// Tables and threads are allocated once, after all options are set.
+func New(options map[string]string) (*Engine, error) {
+	e := NewEngine()
+	for name, value := range options {
+		option, err := e.findOption(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := option.SetValue(value); err != nil {
+			return nil, err
+		}
+	}
+	e.NewGame()
+	if err := e.optionsError(); err != nil {
+		e.Close()
+		return nil, err
+	}
+	return &e, nil
+}
+
+// SetOption sets option with given UCI name. Buttons are pressed with empty value.
+// Options are applied immediately, so they cannot be set during search.
+func (e *Engine) SetOption(name, value string) error {
+	if e.isSearching() {
+		return errSearchRunning
+	}
+	option, err := e.findOption(name)
+	if err != nil {
+		return err
+	}
+	if err := option.SetValue(value); err != nil {
+		return err
+	}
+	e.ApplyOptions()
+	switch option {
+	case EngineOption(&e.BookFile):
+		return e.BookError()
+	case EngineOption(&e.SyzygyPath):
+		return e.TablebaseError()
+	}
+	return nil
+}
+
+func (e *Engine) optionsError() error {
+	if err := e.BookError(); err != nil {
+		return err
+	}
+	return e.TablebaseError()
+}
+
+func (e *Engine) findOption(name string) (EngineOption, error) {
+	for _, option := range e.GetOptions() {
+		if strings.EqualFold(option.GetName(), name) {
+			return option, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown option %v", name)
+}
+
+func (e *Engine) isSearching() bool {
+	return atomic.LoadInt32(&e.searching) != 0
+}
+
+// ParsePosition returns positions of the game starting from FEN after given moves in long algebraic notation
+func ParsePosition(fen string, moves ...string) ([]backend.Position, error) {
+	pos, err := backend.ParseFenStrict(fen)
+	if err != nil {
+		return nil, err
+	}
+	positions := []backend.Position{pos}
+	for _, lan := range moves {
+		child, ok := positions[len(positions)-1].MakeMoveLAN(lan)
+		if !ok {
+			return nil, fmt.Errorf("illegal move %v", lan)
+		}
+		positions = append(positions, child)
+	}
+	return positions, nil
+}
+
+// SetPosition sets position searched by StartSearch.
+// Moves are needed to detect repetitions.
+func (e *Engine) SetPosition(fen string, moves ...string) error {
+	if e.isSearching() {
+		return errSearchRunning
+	}
+	positions, err := ParsePosition(fen, moves...)
+	if err != nil {
+		return err
+	}
+	e.positions = positions
+	return nil
+}
+
+// SearchResult is the outcome of search started with StartSearch
+type SearchResult struct {
+	BestMove backend.Move
+	// NullMove if principal variation has only one move
+	PonderMove backend.Move
+	// Scored is false when best move was not searched, e.g. it comes from book
+	// or search was stopped before completing first iteration.
+	// Score, WDL, Depth and Nodes are then zero and PV has only best move.
+	Scored bool
+	Score  UciScore
+	WDL    WDL
+	Depth  int
+	// Nodes searched by all threads
+	Nodes int
+	PV    []backend.Move
+}
+
+// AsyncSearch is a search running in background
+type AsyncSearch struct {
+	// Info receives the same updates as Engine.Update.
+	// When reader falls behind, the oldest buffered updates are dropped, so that search is not slowed down
+	// and the latest updates, including the lines of the final iteration, are always received.
+	// Channel is closed when search finishes.
+	Info   <-chan SearchInfo
+	engine *Engine
+	cancel context.CancelFunc
+	done   chan struct{}
+	result SearchResult
+}
+
+// StartSearch starts search of position set with SetPosition.
+// Search started with LimitsType.Ponder waits for PonderHit or Stop.
+// Search is limited to searchMoves if any are given, all of them have to be legal.
+func (e *Engine) StartSearch(limits LimitsType, searchMoves ...backend.Move) (*AsyncSearch, error) {
+	if !atomic.CompareAndSwapInt32(&e.searching, 0, 1) {
+		return nil, errSearchRunning
+	}
+	positions := e.positions
+	if len(positions) == 0 {
+		positions = []backend.Position{backend.ParseFen(backend.InitialPositionFen)}
+	}
+	legalMoves := backend.GenerateAllLegalMoves(&positions[len(positions)-1])
+	for _, move := range searchMoves {
+		if !isLegalMove(legalMoves, move) {
+			atomic.StoreInt32(&e.searching, 0)
+			return nil, fmt.Errorf("illegal searchmove %v", move.String())
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	info := make(chan SearchInfo, infoBufferSize)
+	search := &AsyncSearch{Info: info, engine: e, cancel: cancel, done: make(chan struct{})}
+	// Last exact results of every line
+	lines := make(map[int]SearchInfo)
+	// Updates are sent only by goroutine running search, so channel can be closed after it returns
+	update := e.Update
+	e.Update = func(si SearchInfo) {
+		if !si.Score.LowerBound && !si.Score.UpperBound {
+			lines[si.MultiPV] = si
+		}
+		select {
+		case info <- si:
+		default:
+			// Oldest update makes room for the newest one, so that the final lines are always delivered.
+			// Updates have only one sender, so the freed slot stays free until the send.
+			select {
+			case <-info:
+			default:
+			}
+			info <- si
+		}
+	}
+	params := SearchParams{Positions: positions, Limits: limits, SearchMoves: searchMoves}
+	go func() {
+		move := e.Search(ctx, params)
+		cancel()
+		close(info)
+		search.result = e.newSearchResult(move, lines)
+		e.Update = update
+		atomic.StoreInt32(&e.searching, 0)
+		close(search.done)
+	}()
+	return search, nil
+}
+
+func isLegalMove(legalMoves []backend.EvaledMove, move backend.Move) bool {
+	for _, legal := range legalMoves {
+		if legal.Move == move {
+			return true
+		}
+	}
+	return false
+}
+
+// Best move can be different from the first move of the best line, e.g. when strength is limited,
+// so it is looked up among all lines of the last iteration, including those not reported.
+// Root tablebase move is not searched, so it is known only from reported lines.
+func (e *Engine) newSearchResult(move backend.Move, reported map[int]SearchInfo) SearchResult {
+	result := SearchResult{BestMove: move, PV: []backend.Move{move}}
+	for i := range e.lastLines {
+		if e.lastLines[i].Move == move {
+			result.setLine(e.lineInfo(e.lastLines[i], i+1, e.nodes()))
+			return result
+		}
+	}
+	for _, line := range reported {
+		if !line.Book && len(line.Moves) > 0 && line.Moves[0] == move {
+			result.setLine(line)
+			break
+		}
+	}
+	return result
+}
+
+func (r *SearchResult) setLine(line SearchInfo) {
+	r.Scored = true
+	r.Score = line.Score
+	r.WDL = line.WDL
+	r.Depth = line.Depth
+	r.Nodes = line.Nodes
+	if len(line.Moves) > 0 {
+		r.PV = line.Moves
+	}
+	if len(r.PV) >= 2 {
+		r.PonderMove = r.PV[1]
+	}
+}
+
+// Stop stops search. Result is available from Wait.
+func (s *AsyncSearch) Stop() {
+	s.cancel()
+}
+
+// PonderHit switches pondering search to normal time management
+func (s *AsyncSearch) PonderHit() {
+	s.engine.PonderHit()
+}
+
+// Done is closed when search finishes
+func (s *AsyncSearch) Done() <-chan struct{} {
+	return s.done
+}
+
+// Wait blocks until search finishes and returns its result
+func (s *AsyncSearch) Wait() SearchResult {
+	<-s.done
+	return s.result
+}
@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mhib/combusken/backend"
+)
+
+func TestAsyncSearch(t *testing.T) {
+	e, err := New(map[string]string{"Hash": "16", "MultiPV": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	if err := e.SetPosition("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "e2e4", "e7e5"); err != nil {
+		t.Fatal(err)
+	}
+	search, err := e.StartSearch(LimitsType{Depth: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.StartSearch(LimitsType{Depth: 6}); err == nil {
+		t.Errorf("expected error when search is running")
+	}
+	if err := e.SetOption("Hash", "32"); err == nil {
+		t.Errorf("expected error when option is set during search")
+	}
+	if err := e.SetPosition("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"); err == nil {
+		t.Errorf("expected error when position is set during search")
+	}
+	updates := 0
+	for range search.Info {
+		updates++
+	}
+	result := search.Wait()
+	if updates == 0 {
+		t.Errorf("no updates received")
+	}
+	if result.BestMove == 0 || result.Depth == 0 || len(result.PV) < 2 || result.PV[0] != result.BestMove || result.PonderMove != result.PV[1] {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	search, err = e.StartSearch(LimitsType{Infinite: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	search.Stop()
+	if result := search.Wait(); result.BestMove == 0 {
+		t.Errorf("stopped search did not return a move")
+	}
+}
+
+func TestAsyncSearchFinalLines(t *testing.T) {
+	e, err := New(map[string]string{"Hash": "16", "MultiPV": "8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	// Updates are read only after search finishes, when there are more of them than the buffer holds
+	search, err := e.StartSearch(LimitsType{Depth: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := search.Wait()
+	updates := 0
+	final := make(map[int]SearchInfo)
+	for si := range search.Info {
+		updates++
+		if si.Depth == result.Depth && !si.Score.LowerBound && !si.Score.UpperBound {
+			final[si.MultiPV] = si
+		}
+	}
+	if updates != infoBufferSize {
+		t.Errorf("expected full buffer of %d updates, got %d", infoBufferSize, updates)
+	}
+	if len(final) != 8 {
+		t.Errorf("expected 8 lines of final depth %d, got %d", result.Depth, len(final))
+	}
+	if len(final[1].Moves) == 0 || final[1].Moves[0] != result.BestMove {
+		t.Errorf("expected final best line starting with %v, got %+v", result.BestMove, final[1])
+	}
+}
+
+func TestSearchResultOfUnreportedLine(t *testing.T) {
+	e, err := New(map[string]string{"Hash": "16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	// Weakened engine searches more lines than reported MultiPV
+	e.SkillLevel.Val = 0
+	reported := make(map[int]SearchInfo)
+	e.Update = func(si SearchInfo) {
+		reported[si.MultiPV] = si
+	}
+	e.Search(context.Background(), SearchParams{Positions: []backend.Position{backend.InitialPosition}, Limits: LimitsType{Depth: 4}})
+	if len(e.lastLines) < 2 || len(reported) != 1 {
+		t.Fatalf("expected several searched lines and one reported, got %d and %d", len(e.lastLines), len(reported))
+	}
+	line := e.lastLines[1]
+	result := e.newSearchResult(line.Move, reported)
+	if !result.Scored || result.Depth != line.depth || result.Score != newUciScore(line.value) ||
+		result.Nodes != e.nodes() || len(result.PV) == 0 || result.PV[0] != line.Move {
+		t.Errorf("unexpected result %+v for line %+v", result, line)
+	}
+
+	e.lastLines = nil
+	if result := e.newSearchResult(line.Move, nil); result.Scored || result.Depth != 0 || len(result.PV) != 1 {
+		t.Errorf("expected unscored result, got %+v", result)
+	}
+}
+
+func TestEngineErrors(t *testing.T) {
+	if _, err := New(map[string]string{"Unknown": "1"}); err == nil {
+		t.Errorf("expected error for unknown option")
+	}
+	if _, err := New(map[string]string{"Hash": "16", "Threads": "0"}); err == nil {
+		t.Errorf("expected error for invalid option value")
+	}
+	e, _ := New(map[string]string{"Hash": "16"})
+	defer e.Close()
+	if err := e.SetPosition("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "e2e5"); err == nil {
+		t.Errorf("expected error for illegal move")
+	}
+	illegal := backend.NewMove(backend.E2, backend.E5, backend.Pawn, backend.None, backend.QuietMove)
+	if _, err := e.StartSearch(LimitsType{Depth: 1}, illegal); err == nil {
+		t.Errorf("expected error for illegal searchmove")
+	}
+	search, err := e.StartSearch(LimitsType{Depth: 1})
+	if err != nil {
+		t.Fatalf("search could not be started after refused one: %v", err)
+	}
+	search.Wait()
+}
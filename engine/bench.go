@@ -63,5 +63,5 @@ func Benchmark() {
 	duration := time.Since(start)
 	fmt.Printf("Time\t:\t%d\n", duration.Nanoseconds()/1e6)
 	fmt.Printf("Nodes\t:\t%d\n", nodes)
-	fmt.Printf("NPS\t:\t%d\n", int64(nodes)/(duration.Nanoseconds()/1e9))
+	fmt.Printf("NPS\t:\t%d\n", int64(float64(nodes)/duration.Seconds()))
 }
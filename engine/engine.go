@@ -2,10 +2,16 @@ package engine
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"math/rand"
+	"os"
 	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/mhib/combusken/backend"
+	"github.com/mhib/combusken/book"
 	"github.com/mhib/combusken/evaluation"
 	"github.com/mhib/combusken/fathom"
 	"github.com/mhib/combusken/transposition"
@@ -17,8 +23,6 @@ const MAX_HEIGHT = 127
 const STACK_SIZE = MAX_HEIGHT + 1
 const MAX_MOVES = 256
 
-var errTimeout = errors.New("Search timeout")
-
 type Engine struct {
 	Hash              IntOption
 	Threads           IntOption
@@ -26,24 +30,81 @@ type Engine struct {
 	PawnHash          IntOption
 	SyzygyPath        StringOption
 	SyzygyProbeDepth  IntOption
+	Ponder            CheckOption
+	MultiPV           IntOption
+	Chess960          CheckOption
+	OwnBook           CheckOption
+	BookFile          StringOption
+	BookDepth         IntOption
+	ShowWDL           CheckOption
+	LimitStrength     CheckOption
+	Elo               IntOption
+	SkillLevel        IntOption
+	Contempt          IntOption
+	AnalyseMode       CheckOption
+	ClearHash         ButtonOption
+	Deterministic     CheckOption
 	done              <-chan struct{}
 	RepeatedPositions map[uint64]interface{}
 	MovesCount        int
 	Update            func(SearchInfo)
+	// UpdateCurrentMove receives root moves searched by main thread in long searches
+	UpdateCurrentMove func(CurrentMoveInfo)
+	ponderhit         chan struct{}
+	stop              context.CancelFunc
+	nodesLimit        int64
+	searchedNodes     int64
+	// Depth after which no thread starts next iteration, 0 if search is not limited by depth
+	depthLimit    int
+	contempt      int
+	transTable    transposition.TranspositionTable
+	pawnKingTable evaluation.PawnKingTable
+	hashSize      int
+	pawnHashSize  int
+	book          *book.Book
+	bookErr       error
+	// Path of tablebases acquired by engine
+	tablebasePath string
+	tablebaseErr  error
+	// Lines of the last completed iteration
+	lastLines []result
+	// Iteration of lastLines, zero if no lines were reported in current search
+	reported iteration
+	// Game set with SetPosition
+	positions []backend.Position
+	searching int32
+	random    *rand.Rand
 	timeManager
 	threads []thread
+	// Helper threads that have not finished current search
+	helpers *sync.WaitGroup
 }
 
 type thread struct {
 	engine *Engine
+	index  int
+	// Root moves of searches run by helper thread
+	jobs chan []backend.EvaledMove
 	MoveHistory
-	nodes int
-	stack [STACK_SIZE]StackEntry
+	// Counters are read by main thread while helpers search, so they are accessed atomically
+	nodes    int64
+	tbhits   int64
+	pvIdx    int
+	seldepth int
+	stopped  bool
+	stack    [STACK_SIZE]StackEntry
+	// Lines of the last iteration completed by thread
+	linesMu        sync.Mutex
+	lines          []result
+	completedDepth int
 }
 
 type UciScore struct {
 	Mate      int
 	Centipawn int
+	// Set when score comes from search that failed outside of aspiration window
+	LowerBound bool
+	UpperBound bool
 }
 
 func newUciScore(score int) UciScore {
@@ -58,11 +119,27 @@ func newUciScore(score int) UciScore {
 
 type SearchInfo struct {
 	Score    UciScore
+	WDL      WDL
 	Depth    int
+	SelDepth int
 	Nodes    int
 	Nps      int
 	Duration int
 	Moves    []backend.Move
+	MultiPV  int
+	// Permill of transposition table used in current search
+	HashFull int
+	TbHits   int
+	// Set for move played from book without search, only Moves and MultiPV are filled
+	Book bool
+}
+
+// CurrentMoveInfo reports root move that is currently searched
+type CurrentMoveInfo struct {
+	Depth int
+	Move  backend.Move
+	// 1-based position of move in root moves
+	Number int
 }
 
 type StackEntry struct {
@@ -103,6 +180,8 @@ type LimitsType struct {
 type SearchParams struct {
 	Positions []backend.Position
 	Limits    LimitsType
+	// If not empty only these moves are searched in root
+	SearchMoves []backend.Move
 }
 
 func (e *Engine) GetInfo() (name, version, author string) {
@@ -110,7 +189,7 @@ func (e *Engine) GetInfo() (name, version, author string) {
 }
 
 func (e *Engine) GetOptions() []EngineOption {
-	return []EngineOption{&e.Hash, &e.Threads, &e.PawnHash, &e.MoveOverhead, &e.SyzygyPath, &e.SyzygyProbeDepth}
+	return []EngineOption{&e.Hash, &e.Threads, &e.PawnHash, &e.MoveOverhead, &e.SyzygyPath, &e.SyzygyProbeDepth, &e.Ponder, &e.MultiPV, &e.Chess960, &e.OwnBook, &e.BookFile, &e.BookDepth, &e.ShowWDL, &e.LimitStrength, &e.Elo, &e.SkillLevel, &e.Contempt, &e.AnalyseMode, &e.ClearHash, &e.Deterministic}
 }
 
 func NewEngine() (ret Engine) {
@@ -120,22 +199,130 @@ func NewEngine() (ret Engine) {
 	ret.MoveOverhead = IntOption{"Move Overhead", 0, 10000, 50}
 	ret.SyzygyPath = StringOption{"SyzygyPath", "", false}
 	ret.SyzygyProbeDepth = IntOption{"SyzygyProbeDepth", 0, 100, 0}
+	ret.Ponder = CheckOption{"Ponder", false}
+	ret.MultiPV = IntOption{"MultiPV", 1, MAX_MOVES, 1}
+	ret.Chess960 = CheckOption{"UCI_Chess960", false}
+	ret.OwnBook = CheckOption{"OwnBook", false}
+	ret.BookFile = StringOption{"BookFile", "", false}
+	ret.BookDepth = IntOption{"BookDepth", 1, 1000, 20}
+	ret.ShowWDL = CheckOption{"UCI_ShowWDL", false}
+	ret.LimitStrength = CheckOption{"UCI_LimitStrength", false}
+	ret.Elo = IntOption{"UCI_Elo", minSkillElo, maxSkillElo, maxSkillElo}
+	ret.SkillLevel = IntOption{"Skill Level", 0, maxSkillLevel, maxSkillLevel}
+	ret.Contempt = IntOption{"Contempt", -100, 100, 0}
+	ret.AnalyseMode = CheckOption{"UCI_AnalyseMode", false}
+	ret.ClearHash = ButtonOption{"Clear Hash", false}
+	ret.Deterministic = CheckOption{"Deterministic", false}
+	ret.random = rand.New(rand.NewSource(time.Now().UnixNano()))
 	ret.threads = make([]thread, 1)
+	ret.helpers = &sync.WaitGroup{}
 	ret.Update = func(SearchInfo) {}
+	ret.UpdateCurrentMove = func(CurrentMoveInfo) {}
+	ret.ponderhit = make(chan struct{}, 1)
 	return
 }
 
 func (e *Engine) Search(ctx context.Context, searchParams SearchParams) backend.Move {
+	// Ponderhit can arrive after previous search was stopped
+	e.clearPonderHit()
+	e.transTable.NewSearch()
 	e.fillMoveHistory(searchParams.Positions)
-	e.timeManager = newTimeManager(searchParams.Limits, e.MoveOverhead.Val, searchParams.Positions[len(searchParams.Positions)-1].SideToMove)
-	var cancel context.CancelFunc
-	ctx, cancel = context.WithCancel(ctx)
+	limits, maxDepth := e.limitStrength(searchParams.Limits)
+	e.timeManager = newTimeManager(limits, maxDepth, e.MoveOverhead.Val, searchParams.Positions[len(searchParams.Positions)-1].SideToMove)
+	// Timeout is derived from cancelable context, so cancel stops search also when time is limited
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	if e.hardTimeout() > 0 {
-		ctx, cancel = context.WithTimeout(ctx, e.hardTimeout())
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, e.hardTimeout())
+		defer cancelTimeout()
 	}
-	defer cancel()
 	e.done = ctx.Done()
-	return e.bestMove(ctx, &searchParams.Positions[len(searchParams.Positions)-1])
+	e.nodesLimit = int64(limits.Nodes)
+	e.depthLimit = limits.Depth
+	e.searchedNodes = 0
+	e.lastLines = nil
+	e.reported = iteration{}
+	// Analysis should show objective score
+	if e.AnalyseMode.Val {
+		e.contempt = 0
+	} else {
+		e.contempt = e.Contempt.Val
+	}
+	// Random choices depend only on position, so that the same search gives the same move
+	if e.Deterministic.Val {
+		e.random.Seed(int64(searchParams.Positions[len(searchParams.Positions)-1].Key))
+	}
+	ponderManager, pondering := findPonderManager(e.timeManager)
+	if !pondering && !searchParams.Limits.Infinite && len(searchParams.SearchMoves) == 0 {
+		if move, ok := e.bookMove(&searchParams.Positions[len(searchParams.Positions)-1]); ok {
+			e.Update(SearchInfo{Book: true, MultiPV: 1, Moves: []backend.Move{move}})
+			return move
+		}
+	}
+	if pondering {
+		go e.waitForPonderHit(ctx, cancel, ponderManager)
+	}
+	move := e.bestMove(ctx, &searchParams.Positions[len(searchParams.Positions)-1], searchParams.SearchMoves)
+	if e.isStrengthLimited() {
+		move = e.pickSkillMove(e.lastLines, move)
+	}
+	if pondering {
+		// Best move cannot be returned before ponderhit or stop
+		select {
+		case <-ponderManager.hitChan:
+		case <-ctx.Done():
+		}
+	} else if searchParams.Limits.Infinite {
+		// Search can finish earlier because of mate or limited strength,
+		// but best move cannot be returned before stop
+		<-ctx.Done()
+	}
+	return move
+}
+
+// PonderHit switches search started with LimitsType.Ponder to normal time management.
+// Time spent on pondering is treated as already used.
+// Only search that is already running is affected.
+func (e *Engine) PonderHit() {
+	select {
+	case e.ponderhit <- struct{}{}:
+	default:
+	}
+}
+
+func (e *Engine) clearPonderHit() {
+	select {
+	case <-e.ponderhit:
+	default:
+	}
+}
+
+func (e *Engine) waitForPonderHit(ctx context.Context, cancel context.CancelFunc, manager *ponderTimeManager) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-e.ponderhit:
+	}
+	manager.ponderHit()
+	if hardTimeout := manager.timeManager.hardTimeout(); hardTimeout > 0 {
+		timer := time.AfterFunc(hardTimeout-manager.getElapsedTime(), cancel)
+		<-ctx.Done()
+		timer.Stop()
+	}
+}
+
+// BookError returns error of the last attempt to load BookFile
+func (e *Engine) BookError() error {
+	return e.bookErr
+}
+
+// Book is used only up to BookDepth full moves
+func (e *Engine) bookMove(pos *backend.Position) (backend.Move, bool) {
+	if !e.OwnBook.Val || e.book == nil || pos.FullMove > e.BookDepth.Val {
+		return backend.NullMove, false
+	}
+	return e.book.PickMove(pos, e.random)
 }
 
 func (e *Engine) fillMoveHistory(positions []backend.Position) {
@@ -156,37 +343,160 @@ func (e *Engine) fillMoveHistory(positions []backend.Position) {
 }
 
 func (e *Engine) NewGame() {
-	transposition.GlobalTransTable = transposition.NewTransTable(e.Hash.Val)
-	e.threads = make([]thread, e.Threads.Val)
+	e.ApplyOptions()
+	e.transTable.Clear()
+	e.pawnKingTable.Clear()
 	for i := range e.threads {
 		e.threads[i].MoveHistory = MoveHistory{}
+	}
+	runtime.GC()
+}
+
+// ApplyOptions applies changed options without clearing state of the game.
+// It must not be called during search.
+func (e *Engine) ApplyOptions() {
+	if e.transTable.Buckets == nil || e.hashSize != e.Hash.Val {
+		e.transTable = transposition.NewTransTable(e.Hash.Val)
+		e.hashSize = e.Hash.Val
+	}
+	if e.ClearHash.Pressed {
+		e.transTable.Clear()
+		e.ClearHash.Release()
+	}
+	if len(e.threads) != e.Threads.Val {
+		e.resizeThreads(e.Threads.Val)
+	}
+	for i := range e.threads {
 		e.threads[i].engine = e
 	}
-	evaluation.GlobalPawnKingTable = evaluation.NewPawnKingTable(e.PawnHash.Val)
-	fathom.MIN_PROBE_DEPTH = e.SyzygyProbeDepth.Val
+	if e.pawnKingTable.Entries == nil || e.pawnHashSize != e.PawnHash.Val {
+		e.pawnKingTable = evaluation.NewPawnKingTable(e.PawnHash.Val)
+		e.pawnHashSize = e.PawnHash.Val
+	}
 	if e.SyzygyPath.Dirty {
-		fathom.SetPath(e.SyzygyPath.Val)
+		e.releaseTablebases()
+		e.tablebaseErr = nil
+		if e.SyzygyPath.Val != "" {
+			if e.tablebaseErr = fathom.Acquire(e.SyzygyPath.Val); e.tablebaseErr == nil {
+				e.tablebasePath = e.SyzygyPath.Val
+			}
+		}
 		e.SyzygyPath.Clean()
 	}
-	runtime.GC()
+	if e.BookFile.Dirty {
+		e.book, e.bookErr = nil, nil
+		if e.BookFile.Val != "" {
+			e.book, e.bookErr = book.Load(e.BookFile.Val)
+		}
+		e.BookFile.Clean()
+	}
+}
+
+// Tablebases are loaded by fathom for the whole process,
+// so engine that has not acquired them does not use tables loaded by other engines
+func (e *Engine) isTablebaseEnabled() bool {
+	return e.tablebasePath != ""
+}
+
+func (e *Engine) releaseTablebases() {
+	if e.tablebasePath != "" {
+		fathom.Release()
+		e.tablebasePath = ""
+	}
+}
+
+// TablebaseError returns error of the last attempt to load SyzygyPath.
+// Tablebases are shared by all engines of the process, so engines cannot use different paths at the same time.
+func (e *Engine) TablebaseError() error {
+	return e.tablebaseErr
+}
+
+// Close stops helper threads and releases tablebases. Engine cannot be used afterwards.
+func (e *Engine) Close() {
+	e.closeHelpers()
+	e.threads = nil
+	e.releaseTablebases()
+}
+
+// SaveHash writes transposition table to file
+func (e *Engine) SaveHash(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = e.transTable.Save(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// LoadHash replaces transposition table with one saved by SaveHash.
+// Hash option is set to size of loaded table, so tables smaller than minimal Hash are rejected.
+// Table is cleared by NewGame, so it should be loaded after it.
+func (e *Engine) LoadHash(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	table, err := transposition.LoadTransTable(file, info.Size(), e.Hash.Max)
+	if err != nil {
+		return err
+	}
+	// Hash option has to stay in its range, while smaller tables are not allocated by the engine itself
+	if table.Megabytes() < e.Hash.Min {
+		return fmt.Errorf("table of %d MB is smaller than minimal Hash %d MB", table.Megabytes(), e.Hash.Min)
+	}
+	e.transTable = table
+	e.Hash.Val = table.Megabytes()
+	e.hashSize = e.Hash.Val
+	return nil
 }
 
 func (e *Engine) nodes() (sum int) {
 	for i := range e.threads {
-		sum += e.threads[i].nodes
+		sum += int(atomic.LoadInt64(&e.threads[i].nodes))
+	}
+	return
+}
+
+func (e *Engine) tbhits() (sum int) {
+	for i := range e.threads {
+		sum += int(atomic.LoadInt64(&e.threads[i].tbhits))
 	}
 	return
 }
 
-func (t *thread) incNodes() {
-	t.nodes++
-	if (t.nodes % 255) == 0 {
+func (t *thread) updateSeldepth(height int) {
+	if height > t.seldepth {
+		t.seldepth = height
+	}
+}
+
+// incNodes counts node and returns true if search should be stopped
+func (t *thread) incNodes() bool {
+	if t.stopped {
+		return true
+	}
+	// Nodes limit is shared between all threads, so it is checked on every node
+	if t.engine.nodesLimit > 0 && atomic.AddInt64(&t.engine.searchedNodes, 1) > t.engine.nodesLimit {
+		t.engine.stop()
+		t.stopped = true
+		return true
+	}
+	if (atomic.AddInt64(&t.nodes, 1) % 255) == 0 {
 		select {
 		case <-t.engine.done:
-			panic(errTimeout)
+			t.stopped = true
 		default:
 		}
 	}
+	return t.stopped
 }
 
 func (t *thread) getNextMove(pos *backend.Position, depth, height int) backend.Move {
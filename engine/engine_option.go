@@ -70,3 +70,50 @@ func (option *StringOption) SetValue(value string) error {
 	option.Dirty = true
 	return nil
 }
+
+type CheckOption struct {
+	Name string
+	Val  bool
+}
+
+func (option *CheckOption) ToUci() string {
+	return fmt.Sprintf("option name %v type %v default %v",
+		option.Name, "check", option.Val)
+}
+
+func (option *CheckOption) GetName() string {
+	return option.Name
+}
+
+func (option *CheckOption) SetValue(value string) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return errors.New("Invalid setoption arguments")
+	}
+	option.Val = v
+	return nil
+}
+
+// ButtonOption is pressed by setoption without value.
+// Action is performed by the engine, which releases button afterwards.
+type ButtonOption struct {
+	Name    string
+	Pressed bool
+}
+
+func (option *ButtonOption) ToUci() string {
+	return fmt.Sprintf("option name %v type %v", option.Name, "button")
+}
+
+func (option *ButtonOption) GetName() string {
+	return option.Name
+}
+
+func (option *ButtonOption) Release() {
+	option.Pressed = false
+}
+
+func (option *ButtonOption) SetValue(string) error {
+	option.Pressed = true
+	return nil
+}
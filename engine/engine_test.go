@@ -3,10 +3,17 @@ package engine
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	. "github.com/mhib/combusken/backend"
+	"github.com/mhib/combusken/book"
+	"github.com/mhib/combusken/transposition"
 )
 
 func TestWAC(t *testing.T) {
@@ -19,7 +26,7 @@ func TestWAC(t *testing.T) {
 		result := engine.Search(context.Background(), SearchParams{Positions: []Position{entry.Position}, Limits: LimitsType{MoveTime: 1000}}) // search for 1 second
 		found := false
 		for _, move := range entry.bestMoves {
-			if ParseMoveSAN(&entry.Position, move) == result {
+			if parsed, ok := entry.Position.ParseMoveSAN(move); ok && parsed == result {
 				found = true
 				break
 			}
@@ -39,73 +46,590 @@ func TestWAC(t *testing.T) {
 	}
 }
 
-// SAN parsing from CounterGO
-func moveToSAN(pos *Position, ml []EvaledMove, mv Move) string {
-	const PieceNames = "NBRQK"
-	if mv == WhiteKingSideCastle || mv == BlackKingSideCastle {
-		return "O-O"
+func TestMultiPV(t *testing.T) {
+	engine := NewEngine()
+	engine.Threads.Val = 1
+	engine.Hash.Val = 16
+	engine.MultiPV.Val = 3
+	engine.NewGame()
+	lines := make(map[int]SearchInfo)
+	engine.Update = func(si SearchInfo) {
+		lines[si.MultiPV] = si
 	}
-	if mv == WhiteQueenSideCastle || mv == BlackQueenSideCastle {
-		return "O-O-O"
+	engine.Search(context.Background(), SearchParams{Positions: []Position{InitialPosition}, Limits: LimitsType{Depth: 6}})
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
 	}
-	var strPiece, strCapture, strFrom, strTo, strPromotion string
-	if mv.MovedPiece() != Pawn {
-		strPiece = string(PieceNames[mv.MovedPiece()-Knight])
+	for i := 1; i <= 3; i++ {
+		for j := i + 1; j <= 3; j++ {
+			if lines[i].Moves[0] == lines[j].Moves[0] {
+				t.Errorf("lines %d and %d start with the same move %v", i, j, lines[i].Moves[0])
+			}
+		}
+		if i > 1 && lines[i].Score.Centipawn > lines[i-1].Score.Centipawn {
+			t.Errorf("line %d is better than line %d", i, i-1)
+		}
 	}
-	strTo = SquareString[mv.To()]
-	if mv.CapturedPiece() != None {
-		strCapture = "x"
-		if mv.MovedPiece() == Pawn {
-			strFrom = SquareString[mv.From()][:1]
+}
+
+func TestNodesLimit(t *testing.T) {
+	for _, threads := range []int{1, 2} {
+		engine := NewEngine()
+		engine.Threads.Val = threads
+		engine.Hash.Val = 16
+		engine.NewGame()
+		engine.Search(context.Background(), SearchParams{Positions: []Position{InitialPosition}, Limits: LimitsType{Nodes: 20000}})
+		if nodes := engine.nodes(); nodes != 20000 {
+			t.Errorf("threads %d: expected 20000 nodes, got %d", threads, nodes)
 		}
+		engine.Close()
 	}
-	if mv.IsPromotion() {
-		strPromotion = "=" + string(PieceNames[mv.PromotedPiece()-Knight])
+}
+
+func TestMateLimit(t *testing.T) {
+	// Mate in 2 is found in the first iteration thanks to check extensions,
+	// so without mate limit search would continue until depth 3
+	pos := ParseFen("r1bq2rk/pp3pbp/2p1p1pQ/7P/3P4/2PB1N2/PP3PPR/2KR4 w - - 0 1")
+	for _, limits := range []LimitsType{
+		{Mate: 2},
+		{Mate: 2, WhiteTime: 600000, BlackTime: 600000},
+	} {
+		engine := NewEngine()
+		engine.Threads.Val = 1
+		engine.Hash.Val = 16
+		engine.NewGame()
+		var last SearchInfo
+		engine.Update = func(si SearchInfo) {
+			last = si
+		}
+		start := time.Now()
+		move := engine.Search(context.Background(), SearchParams{Positions: []Position{pos}, Limits: limits})
+		if last.Score.Mate != 2 || move != last.Moves[0] {
+			t.Errorf("%+v: expected mate in 2 with %v, got %+v", limits, move, last)
+		}
+		if last.Depth >= 3 {
+			t.Errorf("%+v: search continued to depth %d after mate was found", limits, last.Depth)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%+v: search took %v", limits, elapsed)
+		}
 	}
-	var ambiguity = false
-	var uniqCol = true
-	var uniqRow = true
-	for _, evaled := range ml {
-		mv1 := evaled.Move
-		if mv1.From() == mv.From() {
-			continue
+}
+
+func TestSearchMoves(t *testing.T) {
+	engine := NewEngine()
+	engine.Threads.Val = 1
+	engine.Hash.Val = 16
+	engine.NewGame()
+	restricted := NewMove(A2, A3, Pawn, None, QuietMove)
+	reported := 0
+	engine.Update = func(si SearchInfo) {
+		reported++
+		if len(si.Moves) == 0 || si.Moves[0] != restricted {
+			t.Errorf("expected pv starting with %v, got %v", restricted, si.Moves)
 		}
-		if mv1.To() != mv.To() {
-			continue
+	}
+	move := engine.Search(context.Background(), SearchParams{Positions: []Position{InitialPosition}, Limits: LimitsType{Depth: 6}, SearchMoves: []Move{restricted}})
+	if move != restricted {
+		t.Errorf("expected %v, got %v", restricted, move)
+	}
+	if reported == 0 {
+		t.Errorf("no lines reported")
+	}
+}
+
+func TestSearchInfo(t *testing.T) {
+	engine := NewEngine()
+	engine.Threads.Val = 1
+	engine.Hash.Val = 16
+	engine.NewGame()
+	var last SearchInfo
+	engine.Update = func(si SearchInfo) {
+		last = si
+	}
+	engine.Search(context.Background(), SearchParams{Positions: []Position{InitialPosition}, Limits: LimitsType{Depth: 6}})
+	if last.SelDepth < last.Depth {
+		t.Errorf("seldepth %d is lower than depth %d", last.SelDepth, last.Depth)
+	}
+	if last.HashFull <= 0 || last.HashFull > 1000 {
+		t.Errorf("invalid hashfull %d", last.HashFull)
+	}
+}
+
+func TestFailLowReport(t *testing.T) {
+	engine := NewEngine()
+	engine.Hash.Val = 16
+	engine.NewGame()
+	// Bounds are reported only in long searches
+	engine.timeManager = &depthMoveTimeManager{timeElapser: timeElapser{startedAt: time.Now().Add(-time.Hour)}}
+	var infos []SearchInfo
+	engine.Update = func(si SearchInfo) {
+		infos = append(infos, si)
+	}
+	thread := &engine.threads[0]
+	e4, e5, d4 := NewMove(E2, E4, Pawn, None, DoublePawnPush), NewMove(E7, E5, Pawn, None, DoublePawnPush), NewMove(D2, D4, Pawn, None, DoublePawnPush)
+
+	// Without previous iteration there is no PV to report
+	thread.reportBound(result{Move: d4, value: -50, depth: 5}, false)
+	if len(infos) != 0 {
+		t.Fatalf("reported fail low without PV: %+v", infos)
+	}
+
+	thread.setLines(4, []result{{Move: e4, value: 30, depth: 4, moves: []Move{e4, e5}}})
+	thread.reportBound(result{Move: d4, value: -50, depth: 5}, false)
+	if len(infos) != 1 || !infos[0].Score.UpperBound || infos[0].Score.Centipawn != -50 ||
+		len(infos[0].Moves) != 2 || infos[0].Moves[0] != e4 || infos[0].Moves[1] != e5 {
+		t.Errorf("expected upperbound with PV of previous iteration, got %+v", infos)
+	}
+}
+
+func TestFailHighReport(t *testing.T) {
+	engine := NewEngine()
+	engine.Hash.Val = 16
+	engine.NewGame()
+	// Bounds are reported only in long searches
+	engine.timeManager = &depthMoveTimeManager{timeElapser: timeElapser{startedAt: time.Now().Add(-time.Hour)}}
+	var infos []SearchInfo
+	engine.Update = func(si SearchInfo) {
+		infos = append(infos, si)
+	}
+	thread := &engine.threads[0]
+	thread.stack[0].position = InitialPosition
+	moves := GenerateAllLegalMoves(&InitialPosition)
+	firstMove := moves[0].Move
+	// Window far below real score makes the first root move fail high
+	thread.aspirationWindow(WindowDepth, -1000, moves)
+	if len(infos) == 0 || !infos[0].Score.LowerBound {
+		t.Fatalf("expected lowerbound report, got %+v", infos)
+	}
+	if len(infos[0].Moves) == 0 || infos[0].Moves[0] != firstMove {
+		t.Errorf("expected lowerbound PV starting with %v, got %v", firstMove, infos[0].Moves)
+	}
+}
+
+func TestCurrentMoveReport(t *testing.T) {
+	engine := NewEngine()
+	engine.Hash.Val = 16
+	engine.NewGame()
+	// Root moves are reported only in long searches
+	engine.timeManager = &depthMoveTimeManager{timeElapser: timeElapser{startedAt: time.Now().Add(-time.Hour)}}
+	engine.Update = func(si SearchInfo) {
+		t.Errorf("current move reported as line: %+v", si)
+	}
+	var infos []CurrentMoveInfo
+	engine.UpdateCurrentMove = func(info CurrentMoveInfo) {
+		infos = append(infos, info)
+	}
+	e4 := NewMove(E2, E4, Pawn, None, DoublePawnPush)
+	engine.threads[0].reportCurrentMove(7, e4, 3)
+	if len(infos) != 1 || infos[0] != (CurrentMoveInfo{Depth: 7, Move: e4, Number: 3}) {
+		t.Errorf("expected current move e2e4, got %+v", infos)
+	}
+}
+
+func TestWDL(t *testing.T) {
+	for _, score := range []int{-500, -100, 0, 50, 300} {
+		wdl := newWDL(score)
+		if wdl.Win+wdl.Draw+wdl.Loss != 1000 || wdl.Draw < 0 {
+			t.Errorf("score %d: invalid wdl %v", score, wdl)
 		}
-		if mv1.MovedPiece() != mv.MovedPiece() {
-			continue
+		if mirrored := newWDL(-score); mirrored.Win != wdl.Loss || mirrored.Loss != wdl.Win {
+			t.Errorf("score %d: wdl %v is not symmetric to %v", score, wdl, mirrored)
 		}
-		ambiguity = true
-		if File(mv1.From()) == File(mv.From()) {
-			uniqCol = false
+	}
+	if newWDL(100).Win <= newWDL(0).Win {
+		t.Errorf("win probability should grow with score")
+	}
+	if wdl := newWDL(winIn(5)); wdl.Win != 1000 {
+		t.Errorf("expected certain win for mate score, got %v", wdl)
+	}
+}
+
+func TestSkillLevel(t *testing.T) {
+	engine := NewEngine()
+	engine.Threads.Val = 1
+	engine.Hash.Val = 16
+	engine.SkillLevel.Val = 0
+	engine.NewGame()
+	reported := 0
+	engine.Update = func(si SearchInfo) {
+		if si.MultiPV > 1 {
+			t.Errorf("reported line %d that was not requested", si.MultiPV)
 		}
-		if Rank(mv1.From()) == Rank(mv.From()) {
-			uniqRow = false
+		reported++
+	}
+	legalMoves := GenerateAllLegalMoves(&InitialPosition)
+	move := engine.Search(context.Background(), SearchParams{Positions: []Position{InitialPosition}, Limits: LimitsType{Depth: 10}})
+	if !containsEvaledMove(legalMoves, move) {
+		t.Fatalf("illegal move %v", move)
+	}
+	if nodes := engine.nodes(); nodes > 1000 {
+		t.Errorf("expected at most 1000 nodes, got %d", nodes)
+	}
+	if reported == 0 {
+		t.Errorf("no lines reported")
+	}
+}
+
+func TestEloLimit(t *testing.T) {
+	engine := NewEngine()
+	engine.Threads.Val = 1
+	engine.Hash.Val = 16
+	engine.LimitStrength.Val = true
+	engine.Elo.Val = minSkillElo
+	engine.NewGame()
+	maxDepth := 0
+	engine.Update = func(si SearchInfo) {
+		if si.Depth > maxDepth {
+			maxDepth = si.Depth
 		}
 	}
-	if ambiguity {
-		if uniqCol {
-			strFrom = SquareString[mv.From()][:1]
-		} else if uniqRow {
-			strFrom = SquareString[mv.From()][1:2]
+	move := engine.Search(context.Background(), SearchParams{Positions: []Position{InitialPosition}, Limits: LimitsType{Depth: 10}})
+	if move == NullMove {
+		t.Fatalf("no move returned")
+	}
+	if nodes := engine.nodes(); nodes > 1000 {
+		t.Errorf("expected at most 1000 nodes on minimal Elo, got %d", nodes)
+	}
+	if maxDepth != 1 {
+		t.Errorf("expected depth 1 on minimal Elo, got %d", maxDepth)
+	}
+
+	engine.Elo.Val = (minSkillElo + maxSkillElo) / 2
+	limits, depth := engine.limitStrength(LimitsType{})
+	if depth != 11 || limits.Nodes != 32000 {
+		t.Errorf("expected depth 11 and 32000 nodes on middle Elo, got depth %d and %d nodes", depth, limits.Nodes)
+	}
+
+	engine.Elo.Val = maxSkillElo
+	if engine.isStrengthLimited() {
+		t.Errorf("strength should not be limited on maximal Elo")
+	}
+	engine.LimitStrength.Val = false
+	engine.Elo.Val = minSkillElo
+	if engine.isStrengthLimited() {
+		t.Errorf("UCI_Elo should be ignored without UCI_LimitStrength")
+	}
+}
+
+func TestSkillLevelWaitsForStop(t *testing.T) {
+	engine := NewEngine()
+	engine.Hash.Val = 16
+	engine.SkillLevel.Val = 0
+	engine.NewGame()
+	for _, limits := range []LimitsType{{Infinite: true}, {Ponder: true}} {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan Move)
+		go func() {
+			done <- engine.Search(ctx, SearchParams{Positions: []Position{InitialPosition}, Limits: limits})
+		}()
+		select {
+		case <-done:
+			t.Fatalf("%+v: search finished before stop", limits)
+		case <-time.After(200 * time.Millisecond):
+		}
+		if limits.Ponder {
+			engine.PonderHit()
 		} else {
-			strFrom = SquareString[mv.From()]
+			cancel()
+		}
+		if move := <-done; move == NullMove {
+			t.Errorf("%+v: no move returned", limits)
 		}
+		if nodes := engine.nodes(); nodes > 1000 {
+			t.Errorf("%+v: expected at most 1000 nodes, got %d", limits, nodes)
+		}
+		cancel()
+	}
+}
+
+func TestPonderHit(t *testing.T) {
+	engine := NewEngine()
+	engine.Threads.Val = 1
+	engine.Hash.Val = 16
+	engine.NewGame()
+	done := make(chan Move)
+	go func() {
+		// Time for this move is at most 100ms
+		done <- engine.Search(context.Background(), SearchParams{Positions: []Position{InitialPosition}, Limits: LimitsType{Ponder: true, WhiteTime: 1000, BlackTime: 1000}})
+	}()
+	select {
+	case <-done:
+		t.Fatalf("pondering search finished before ponderhit")
+	case <-time.After(300 * time.Millisecond):
+	}
+	// Time is counted from start of pondering, so it is already used up
+	ponderHitAt := time.Now()
+	engine.PonderHit()
+	select {
+	case move := <-done:
+		if !containsEvaledMove(GenerateAllLegalMoves(&InitialPosition), move) {
+			t.Errorf("illegal move %v", move)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("search did not finish after ponderhit")
+	}
+	if elapsed := time.Since(ponderHitAt); elapsed > 500*time.Millisecond {
+		t.Errorf("best move returned %v after ponderhit", elapsed)
+	}
+}
+
+func TestStalePonderHit(t *testing.T) {
+	engine := NewEngine()
+	engine.Hash.Val = 16
+	engine.NewGame()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	engine.Search(ctx, SearchParams{Positions: []Position{InitialPosition}, Limits: LimitsType{Ponder: true}})
+	// Ponderhit that arrives after search stopped
+	engine.PonderHit()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan Move)
+	go func() {
+		done <- engine.Search(ctx, SearchParams{Positions: []Position{InitialPosition}, Limits: LimitsType{Ponder: true, MoveTime: 10}})
+	}()
+	select {
+	case <-done:
+		t.Fatalf("pondering search finished because of stale ponderhit")
+	case <-time.After(200 * time.Millisecond):
+	}
+	engine.PonderHit()
+	if move := <-done; move == NullMove {
+		t.Errorf("no move returned")
+	}
+}
+
+func containsEvaledMove(moves []EvaledMove, move Move) bool {
+	for _, m := range moves {
+		if m.Move == move {
+			return true
+		}
+	}
+	return false
+}
+
+func TestContempt(t *testing.T) {
+	engine := NewEngine()
+	engine.Hash.Val = 16
+	engine.Contempt.Val = 20
+	engine.NewGame()
+	engine.Search(context.Background(), SearchParams{Positions: []Position{InitialPosition}, Limits: LimitsType{Depth: 1}})
+	thread := &engine.threads[0]
+	var child Position
+	InitialPosition.MakeMove(NewMove(E2, E4, Pawn, None, DoublePawnPush), &child)
+	if value := thread.contempt(&InitialPosition); value != -20 {
+		t.Errorf("expected draw score -20 for root side, got %d", value)
+	}
+	if value := thread.contempt(&child); value != 20 {
+		t.Errorf("expected draw score 20 for opponent, got %d", value)
+	}
+
+	engine.AnalyseMode.Val = true
+	engine.Search(context.Background(), SearchParams{Positions: []Position{InitialPosition}, Limits: LimitsType{Depth: 1}})
+	if value := thread.contempt(&InitialPosition); value != 0 {
+		t.Errorf("expected no contempt in analysis, got %d", value)
+	}
+}
+
+func TestApplyOptions(t *testing.T) {
+	engine := NewEngine()
+	engine.Hash.Val = 16
+	engine.NewGame()
+	defer engine.Close()
+	pos := ParseFen(InitialPositionFen)
+	engine.Search(context.Background(), SearchParams{Positions: []Position{pos}, Limits: LimitsType{Depth: 4}})
+
+	engine.Threads.Val = 2
+	engine.ApplyOptions()
+	if len(engine.threads) != 2 || engine.threads[1].engine != &engine {
+		t.Errorf("threads were not resized")
+	}
+	if ok, _, _, _, _, _ := engine.transTable.Get(pos.Key); !ok {
+		t.Errorf("table was cleared without change of its size")
+	}
+
+	engine.ClearHash.SetValue("")
+	engine.ApplyOptions()
+	if ok, _, _, _, _, _ := engine.transTable.Get(pos.Key); ok {
+		t.Errorf("table was not cleared")
+	}
+
+	buckets := len(engine.transTable.Buckets)
+	engine.Hash.Val = 32
+	engine.ApplyOptions()
+	if len(engine.transTable.Buckets) != 2*buckets {
+		t.Errorf("table was not resized")
+	}
+	engine.Search(context.Background(), SearchParams{Positions: []Position{pos}, Limits: LimitsType{Depth: 4}})
+}
+
+func TestIndependentEngines(t *testing.T) {
+	engines := []Engine{NewEngine(), NewEngine()}
+	engines[0].Hash.Val = 8
+	engines[1].Hash.Val = 16
+	done := make(chan Move, len(engines))
+	for i := range engines {
+		engines[i].NewGame()
+		go func(e *Engine) {
+			done <- e.Search(context.Background(), SearchParams{Positions: []Position{InitialPosition}, Limits: LimitsType{Depth: 8}})
+		}(&engines[i])
+	}
+	for range engines {
+		if move := <-done; move == NullMove {
+			t.Errorf("engine did not find a move")
+		}
+	}
+	if 2*len(engines[0].transTable.Buckets) != len(engines[1].transTable.Buckets) {
+		t.Errorf("engines share transposition table")
 	}
-	return strPiece + strFrom + strCapture + strTo + strPromotion
 }
 
-func ParseMoveSAN(pos *Position, san string) Move {
-	var index = strings.IndexAny(san, "+#?!")
-	if index >= 0 {
-		san = san[:index]
+// Set in processes started by TestDeterministic
+const deterministicOutputEnv = "COMBUSKEN_DETERMINISTIC_OUTPUT"
+
+func TestDeterministic(t *testing.T) {
+	if path := os.Getenv(deterministicOutputEnv); path != "" {
+		if err := ioutil.WriteFile(path, []byte(deterministicSearches(t)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	// Fresh processes differ in state of global rand and in map order
+	var outputs []string
+	for i := 0; i < 2; i++ {
+		path := filepath.Join(t.TempDir(), "output")
+		cmd := exec.Command(os.Args[0], "-test.run=^TestDeterministic$")
+		cmd.Env = append(os.Environ(), deterministicOutputEnv+"="+path)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		output, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, string(output))
+	}
+	outputs = append(outputs, deterministicSearches(t))
+	expected := strings.Split(outputs[0], "\n")
+	for _, output := range outputs[1:] {
+		lines := strings.Split(output, "\n")
+		for i := range expected {
+			if i >= len(lines) || lines[i] != expected[i] {
+				t.Fatalf("searches gave different results, expected:\n%v", expected[i])
+			}
+		}
 	}
-	var ml = GenerateAllLegalMoves(pos)
-	for _, mv := range ml {
-		if san == moveToSAN(pos, ml, mv.Move) {
-			return mv.Move
+}
+
+// deterministicSearches returns line of reports for every node limited search
+func deterministicSearches(t *testing.T) string {
+	positions := loadEPD("./test_positions/WinAtChess.epd")
+	var sb strings.Builder
+	for _, skillLevel := range []int{maxSkillLevel, 10} {
+		engine := NewEngine()
+		// Ignored in deterministic search
+		engine.Threads.Val = 2
+		engine.Hash.Val = 16
+		engine.SkillLevel.Val = skillLevel
+		engine.Deterministic.Val = true
+		var infos []SearchInfo
+		engine.Update = func(si SearchInfo) {
+			// Time is the only thing that can differ
+			si.Nps = 0
+			si.Duration = 0
+			infos = append(infos, si)
+		}
+		for _, entry := range positions {
+			engine.NewGame()
+			infos = nil
+			move := engine.Search(context.Background(), SearchParams{Positions: []Position{entry.Position}, Limits: LimitsType{Nodes: 5000}})
+			fmt.Fprintf(&sb, "skill level %d, position #%v: %v %+v\n", skillLevel, entry.id, move, infos)
+			if engine.threads[1].nodes != 0 {
+				t.Errorf("helper thread searched in deterministic search")
+			}
 		}
+		engine.Close()
+	}
+	return sb.String()
+}
+
+func TestLoadHash(t *testing.T) {
+	engine := NewEngine()
+	engine.Hash.Val = 16
+	engine.NewGame()
+	pos := ParseFen(InitialPositionFen)
+	engine.Search(context.Background(), SearchParams{Positions: []Position{pos}, Limits: LimitsType{Depth: 4}})
+	path := filepath.Join(t.TempDir(), "hash.bin")
+	if err := engine.SaveHash(path); err != nil {
+		t.Fatal(err)
+	}
+
+	other := NewEngine()
+	other.Hash.Val = 32
+	other.NewGame()
+	if err := other.LoadHash(path); err != nil {
+		t.Fatal(err)
+	}
+	if other.Hash.Val != 16 {
+		t.Errorf("expected Hash 16 after loading table, got %d", other.Hash.Val)
+	}
+	// Loaded table must survive applying unchanged options
+	other.ApplyOptions()
+	if ok, _, _, _, _, _ := other.transTable.Get(pos.Key); !ok {
+		t.Errorf("loaded table was replaced")
+	}
+
+	small := transposition.NewTransTable(1)
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := small.Save(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.LoadHash(path); err == nil {
+		t.Errorf("expected error for table smaller than minimal Hash")
+	}
+	if other.Hash.Val != 16 || len(other.transTable.Buckets) == len(small.Buckets) {
+		t.Errorf("rejected table changed Hash to %d", other.Hash.Val)
+	}
+}
+
+func TestBookMoveReport(t *testing.T) {
+	e4 := NewMove(E2, E4, Pawn, None, DoublePawnPush)
+	path := filepath.Join(t.TempDir(), "book.bin")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := book.Write(file, []book.Entry{{Key: InitialPosition.PolyglotKey(), Move: book.EncodeMove(e4), Weight: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	engine, err := New(map[string]string{"Hash": "16", "OwnBook": "true", "BookFile": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	search, err := engine.StartSearch(LimitsType{Depth: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var infos []SearchInfo
+	for info := range search.Info {
+		infos = append(infos, info)
+	}
+	if len(infos) != 1 || !infos[0].Book || infos[0].Depth != 0 || len(infos[0].Moves) != 1 || infos[0].Moves[0] != e4 {
+		t.Errorf("expected single book move report, got %+v", infos)
+	}
+	if result := search.Wait(); result.BestMove != e4 || result.Scored {
+		t.Errorf("expected unscored book move %v, got %+v", e4, result)
 	}
-	return NullMove
 }
@@ -3,6 +3,8 @@ package engine
 import (
 	"context"
 	"math/rand"
+	"sync/atomic"
+	"time"
 
 	. "github.com/mhib/combusken/backend"
 	. "github.com/mhib/combusken/evaluation"
@@ -34,6 +36,9 @@ const probCutMargin = 100
 
 const SMPCycles = 16
 
+// Searched root moves and aspiration window fails are reported after this time
+const infoReportDelay = 3 * time.Second
+
 const WindowSize = 25
 const WindowDepth = 6
 
@@ -58,13 +63,16 @@ func depthToMate(val int) int {
 }
 
 func (t *thread) quiescence(depth, alpha, beta, height int, inCheck bool) int {
-	t.incNodes()
+	if t.incNodes() {
+		return 0
+	}
+	t.updateSeldepth(height)
 	t.stack[height].PV.clear()
 	pos := &t.stack[height].position
 	alphaOrig := alpha
 
 	if height >= MAX_HEIGHT || t.isDraw(height) {
-		return t.contempt(pos, depth)
+		return t.contempt(pos)
 	}
 
 	var ttDepth int
@@ -73,7 +81,7 @@ func (t *thread) quiescence(depth, alpha, beta, height int, inCheck bool) int {
 	} else {
 		ttDepth = QSDepthNoChecks
 	}
-	hashOk, hashValue, hashEval, hashDepth, hashMove, hashFlag := transposition.GlobalTransTable.Get(pos.Key)
+	hashOk, hashValue, hashEval, hashDepth, hashMove, hashFlag := t.engine.transTable.Get(pos.Key)
 	if hashOk && hashValue != UnknownValue && int(hashDepth) >= ttDepth {
 		hashValue = transposition.ValueFromTrans(hashValue, height)
 		if hashFlag == TransExact || (hashFlag == TransAlpha && int(hashValue) <= alpha) ||
@@ -110,12 +118,12 @@ func (t *thread) quiescence(depth, alpha, beta, height int, inCheck bool) int {
 			}
 		} else {
 			if pos.LastMove != NullMove {
-				eval = int16(Evaluate(pos))
+				eval = int16(Evaluate(pos, &t.engine.pawnKingTable))
 			} else {
 				eval = -t.getEvaluation(height-1) + 2*Tempo
 			}
 			bestVal = int(eval)
-			transposition.GlobalTransTable.Set(pos.Key, UnknownValue, eval, transposition.NoneDepth, NullMove, TransNone)
+			t.engine.transTable.Set(pos.Key, UnknownValue, eval, transposition.NoneDepth, NullMove, TransNone)
 		}
 		// Early return if not in check and evaluation exceeded beta
 		if bestVal >= beta {
@@ -137,12 +145,15 @@ func (t *thread) quiescence(depth, alpha, beta, height int, inCheck bool) int {
 		}
 
 		// Prefetch as early as possible
-		transposition.GlobalTransTable.Prefetch(child.Key)
+		t.engine.transTable.Prefetch(child.Key)
 
 		t.SetCurrentMove(height, move)
 		moveCount++
 		childInCheck := child.IsInCheck()
 		val := -t.quiescence(depth-1, -beta, -alpha, height+1, childInCheck)
+		if t.stopped {
+			return 0
+		}
 		if val > bestVal {
 			bestVal = val
 			bestMove = move
@@ -170,17 +181,18 @@ func (t *thread) quiescence(depth, alpha, beta, height int, inCheck bool) int {
 		flag = TransExact
 	}
 
-	transposition.GlobalTransTable.Set(pos.Key, transposition.ValueToTrans(alpha, height), eval, ttDepth, bestMove, flag)
+	t.engine.transTable.Set(pos.Key, transposition.ValueToTrans(alpha, height), eval, ttDepth, bestMove, flag)
 
 	return alpha
 }
 
-// Currently draws are scored as 0 +/- 1 randomly
-func (t *thread) contempt(pos *Position, depth int) int {
-	if depth < 4 {
-		return 0
+// contempt returns draw score from side to move perspective.
+// Side to move in root scores draws as -Contempt, so positive values make engine avoid draws.
+func (t *thread) contempt(pos *Position) int {
+	if pos.SideToMove == t.stack[0].position.SideToMove {
+		return -t.engine.contempt
 	}
-	return 2*(t.nodes&1) - 1
+	return t.engine.contempt
 }
 
 func moveCountPruning(improving, depth int) int {
@@ -188,13 +200,16 @@ func moveCountPruning(improving, depth int) int {
 }
 
 func (t *thread) alphaBeta(depth, alpha, beta, height int, inCheck bool, cutNode bool) int {
-	t.incNodes()
+	if t.incNodes() {
+		return 0
+	}
+	t.updateSeldepth(height)
 	t.stack[height].PV.clear()
 
 	var pos *Position = &t.stack[height].position
 
 	if height >= MAX_HEIGHT || t.isDraw(height) {
-		return t.contempt(pos, depth)
+		return t.contempt(pos)
 	}
 
 	// Node is not pv if it is searched with null window
@@ -208,7 +223,7 @@ func (t *thread) alphaBeta(depth, alpha, beta, height int, inCheck bool, cutNode
 	}
 
 	alphaOrig := alpha
-	hashOk, hashValue, hashEval, hashDepth, hashMove, hashFlag := transposition.GlobalTransTable.Get(pos.Key)
+	hashOk, hashValue, hashEval, hashDepth, hashMove, hashFlag := t.engine.transTable.Get(pos.Key)
 	var val int
 	if hashOk && hashValue != UnknownValue {
 		hashValue = transposition.ValueFromTrans(hashValue, height)
@@ -228,8 +243,9 @@ func (t *thread) alphaBeta(depth, alpha, beta, height int, inCheck bool, cutNode
 	}
 
 	// Probe tablebase
-	if fathom.IsWDLProbeable(pos, depth) {
+	if t.engine.isTablebaseEnabled() && fathom.IsWDLProbeable(pos, depth, t.engine.SyzygyProbeDepth.Val) {
 		if tbResult := fathom.ProbeWDL(pos, depth); tbResult != fathom.TB_RESULT_FAILED {
+			atomic.AddInt64(&t.tbhits, 1)
 			var ttBound int
 			if tbResult == fathom.TB_LOSS {
 				val = ValueLoss + height + 1
@@ -242,7 +258,7 @@ func (t *thread) alphaBeta(depth, alpha, beta, height int, inCheck bool, cutNode
 				ttBound = TransExact
 			}
 			if ttBound == TransExact || ttBound == TransBeta && val >= beta || ttBound == TransAlpha && val <= alpha {
-				transposition.GlobalTransTable.Set(pos.Key, int16(val), UnknownValue, MAX_HEIGHT, NullMove, ttBound)
+				t.engine.transTable.Set(pos.Key, int16(val), UnknownValue, MAX_HEIGHT, NullMove, ttBound)
 				return val
 			}
 		}
@@ -278,12 +294,12 @@ func (t *thread) alphaBeta(depth, alpha, beta, height int, inCheck bool, cutNode
 		}
 	} else {
 		if pos.LastMove != NullMove {
-			eval = int16(Evaluate(pos))
+			eval = int16(Evaluate(pos, &t.engine.pawnKingTable))
 		} else {
 			eval = -t.getEvaluation(height-1) + 2*Tempo
 		}
 		t.setEvaluation(height, eval)
-		transposition.GlobalTransTable.Set(pos.Key, UnknownValue, eval, transposition.NoneDepth, NullMove, TransNone)
+		t.engine.transTable.Set(pos.Key, UnknownValue, eval, transposition.NoneDepth, NullMove, TransNone)
 	}
 
 	if height > 1 {
@@ -361,7 +377,7 @@ afterPreMovesPruning:
 			iiDepth = (depth - 5) / 2
 		}
 		t.alphaBeta(iiDepth, alpha, beta, height, inCheck, cutNode)
-		_, _, _, _, hashMove, _ = transposition.GlobalTransTable.Get(pos.Key)
+		_, _, _, _, hashMove, _ = t.engine.transTable.Get(pos.Key)
 	}
 
 	// Quiet moves are stored in order to reduce their history value at the end of search
@@ -405,7 +421,7 @@ afterPreMovesPruning:
 		t.SetCurrentMove(height, move)
 
 		// Prefetch as early as possible
-		transposition.GlobalTransTable.Prefetch(child.Key)
+		t.engine.transTable.Prefetch(child.Key)
 
 		moveCount++
 		childInCheck := child.IsInCheck()
@@ -460,6 +476,11 @@ afterPreMovesPruning:
 			val = -t.alphaBeta(newDepth, -beta, -alpha, height+1, childInCheck, false)
 		}
 
+		// Values of stopped search are not reliable and cannot be stored
+		if t.stopped {
+			return 0
+		}
+
 		if val > bestVal {
 			bestVal = val
 			bestMove = move
@@ -477,7 +498,7 @@ afterPreMovesPruning:
 		if inCheck {
 			return lossIn(height)
 		}
-		return t.contempt(pos, depth)
+		return t.contempt(pos)
 	}
 
 	if alpha >= beta && bestMove != NullMove && !bestMove.IsCaptureOrPromotion() {
@@ -492,7 +513,7 @@ afterPreMovesPruning:
 	} else {
 		flag = TransExact
 	}
-	transposition.GlobalTransTable.Set(pos.Key, transposition.ValueToTrans(alpha, height), t.getEvaluation(height), depth, bestMove, flag)
+	t.engine.transTable.Set(pos.Key, transposition.ValueToTrans(alpha, height), t.getEvaluation(height), depth, bestMove, flag)
 	return alpha
 }
 
@@ -515,7 +536,7 @@ func (t *thread) isMoveSingular(depth, height int, hashMove Move, hashValue int,
 		}
 		t.SetCurrentMove(height, move)
 		val = -t.alphaBeta(depth/2-1, -rBeta-1, -rBeta, height+1, child.IsInCheck(), cutNode)
-		if val > rBeta {
+		if val > rBeta || t.stopped {
 			break
 		}
 		if !move.IsCaptureOrPromotion() {
@@ -566,9 +587,10 @@ func (t *thread) isDraw(height int) bool {
 
 type result struct {
 	Move
-	value int
-	depth int
-	moves []Move
+	value    int
+	depth    int
+	seldepth int
+	moves    []Move
 }
 
 // https://www.chessprogramming.org/Aspiration_Windows
@@ -587,9 +609,10 @@ func (t *thread) aspirationWindow(depth, lastValue int, moves []EvaledMove) resu
 	}
 	for {
 		res := t.depSearch(Max(1, searchDepth), alpha, beta, moves)
-		if res.value > alpha && res.value < beta {
+		if t.stopped || res.value > alpha && res.value < beta {
 			return res
 		}
+		t.reportBound(res, res.value >= beta)
 		if res.value <= alpha {
 			beta = (alpha + beta) / 2
 			alpha = Max(-Mate, alpha-delta)
@@ -611,7 +634,7 @@ func (t *thread) depSearch(depth, alpha, beta int, moves []EvaledMove) result {
 	alphaOrig := alpha
 	inCheck := pos.IsInCheck()
 	moveCount := 0
-	eval := int16(Evaluate(pos))
+	eval := int16(Evaluate(pos, &t.engine.pawnKingTable))
 	t.setEvaluation(0, eval)
 	t.stack[0].PV.clear()
 	t.ResetKillers(1)
@@ -622,11 +645,12 @@ func (t *thread) depSearch(depth, alpha, beta int, moves []EvaledMove) result {
 	for i := range moves {
 		pos.MakeLegalMove(moves[i].Move, child)
 		// Prefetch as early as possible
-		transposition.GlobalTransTable.Prefetch(child.Key)
+		t.engine.transTable.Prefetch(child.Key)
 
 		t.SetCurrentMove(0, moves[i].Move)
 
 		moveCount++
+		t.reportCurrentMove(depth, moves[i].Move, t.pvIdx+i+1)
 		if !moves[i].IsCaptureOrPromotion() {
 			quietsSearched = append(quietsSearched, moves[i].Move)
 		}
@@ -650,20 +674,27 @@ func (t *thread) depSearch(depth, alpha, beta int, moves []EvaledMove) result {
 		}
 		if reduction > 0 {
 			val = -t.alphaBeta(newDepth-reduction, -(alpha + 1), -alpha, 1, childInCheck, true)
+			if t.stopped {
+				return result{}
+			}
 			if val <= alpha {
 				continue
 			}
 		}
 		val = -t.alphaBeta(newDepth, -beta, -alpha, 1, childInCheck, false)
+		if t.stopped {
+			return result{}
+		}
 		if val > bestVal {
 			bestVal = val
 			bestMove = moves[i].Move
 			if val > alpha {
 				alpha = val
+				// PV is assigned also on fail high, as it is reported with lower bound
+				t.stack[0].PV.assign(moves[i].Move, &t.stack[1].PV)
 				if alpha >= beta {
 					break
 				}
-				t.stack[0].PV.assign(moves[i].Move, &t.stack[1].PV)
 			}
 		}
 	}
@@ -671,7 +702,7 @@ func (t *thread) depSearch(depth, alpha, beta int, moves []EvaledMove) result {
 		if inCheck {
 			alpha = lossIn(0)
 		} else {
-			alpha = t.contempt(pos, depth)
+			alpha = t.contempt(pos)
 		}
 	}
 	if alpha >= beta && bestMove != NullMove && !bestMove.IsCaptureOrPromotion() {
@@ -687,51 +718,118 @@ func (t *thread) depSearch(depth, alpha, beta int, moves []EvaledMove) result {
 	} else {
 		flag = TransExact
 	}
-	transposition.GlobalTransTable.Set(pos.Key, transposition.ValueToTrans(alpha, 0), eval, depth, bestMove, flag)
-	return result{bestMove, alpha, depth, cloneMoves(t.stack[0].PV.items[:t.stack[0].PV.size])}
+	// Lines other than first one are searched without best moves
+	if t.pvIdx == 0 {
+		t.engine.transTable.Set(pos.Key, transposition.ValueToTrans(alpha, 0), eval, depth, bestMove, flag)
+	}
+	return result{bestMove, alpha, depth, t.seldepth, cloneMoves(t.stack[0].PV.items[:t.stack[0].PV.size])}
 }
 
-func (e *Engine) singleThreadBestMove(ctx context.Context, rootMoves []EvaledMove) Move {
-	var lastBestMove Move
-	thread := e.threads[0]
-	var res result
-	lastValue := -Mate
-	for i := 1; ; i++ {
-		resultChan := make(chan result, 1)
-		go func(depth int) {
-			defer recoverFromTimeout()
-			res = thread.aspirationWindow(depth, lastValue, rootMoves)
-			resultChan <- res
-			lastValue = res.value
-		}(i)
-		select {
-		case <-ctx.Done():
-			return lastBestMove
-		case res := <-resultChan:
-			timeSinceStart := e.getElapsedTime()
-			e.Update(SearchInfo{newUciScore(res.value), res.depth, thread.nodes, int(float64(thread.nodes) / timeSinceStart.Seconds()), int(timeSinceStart.Milliseconds()), res.moves})
-			if res.value >= ValueWin && depthToMate(res.value) <= i {
-				return res.Move
-			}
-			if res.Move == 0 {
-				return lastBestMove
-			}
-			if i >= MAX_HEIGHT {
-				return res.Move
-			}
-			e.updateTime(res.depth, res.value)
-			if e.isSoftTimeout(i, thread.nodes) {
-				return res.Move
-			}
-			lastBestMove = res.Move
+// Root moves are reported only by main thread and only in long searches
+func (t *thread) reportCurrentMove(depth int, move Move, number int) {
+	e := t.engine
+	if t.index != 0 || !e.isReportDelayPassed() {
+		return
+	}
+	e.UpdateCurrentMove(CurrentMoveInfo{Depth: depth, Move: move, Number: number})
+}
+
+// reportBound reports result of search that failed outside of aspiration window.
+// Like root moves it is reported only by main thread in long searches.
+func (t *thread) reportBound(res result, lowerBound bool) {
+	e := t.engine
+	if t.index != 0 || !e.isReportDelayPassed() {
+		return
+	}
+	// PV is not updated when search fails low,
+	// so like in Stockfish PV of the line from previous iteration is reported
+	if !lowerBound {
+		if t.pvIdx >= len(t.lines) {
+			return
+		}
+		res.moves = t.lines[t.pvIdx].moves
+	}
+	if len(res.moves) == 0 {
+		return
+	}
+	info := e.lineInfo(res, t.pvIdx+1, e.nodes())
+	info.Score.LowerBound = lowerBound
+	info.Score.UpperBound = !lowerBound
+	e.Update(info)
+}
+
+// Reports sent after delay depend on time, so they are disabled in deterministic mode
+func (e *Engine) isReportDelayPassed() bool {
+	return !e.Deterministic.Val && e.getElapsedTime() >= infoReportDelay
+}
+
+// rootSearch searches MultiPV best lines of root moves.
+// After search first len(lines) root moves are in the same order as lines.
+func (t *thread) rootSearch(depth int, lastValues []int, moves []EvaledMove) []result {
+	lines := make([]result, Max(1, Min(t.engine.multiPV(), len(moves))))
+	t.seldepth = 0
+	for t.pvIdx = range lines {
+		// depSearch sorts moves, so best move of line is always first among not yet picked moves
+		lines[t.pvIdx] = t.aspirationWindow(depth, lastValues[t.pvIdx], moves[t.pvIdx:])
+		if t.stopped {
+			t.pvIdx = 0
+			return nil
+		}
+	}
+	t.pvIdx = 0
+	sortLines(lines, moves)
+	for i := range lines {
+		lastValues[i] = lines[i].value
+	}
+	return lines
+}
+
+// Lines found later can be better than earlier ones as search is not stable
+func sortLines(lines []result, moves []EvaledMove) {
+	for i := 1; i < len(lines); i++ {
+		for j := i; j > 0 && lines[j-1].value < lines[j].value; j-- {
+			lines[j-1], lines[j] = lines[j], lines[j-1]
+			moves[j-1], moves[j] = moves[j], moves[j-1]
 		}
 	}
 }
 
-func (t *thread) iterativeDeepening(moves []EvaledMove, resultChan chan result, idx int) {
-	var res result
-	mainThread := idx == 0
-	lastValue := -Mate
+func newLastValues(lines int) []int {
+	res := make([]int, lines)
+	for i := range res {
+		res[i] = -Mate
+	}
+	return res
+}
+
+func (e *Engine) updateLines(lines []result, it iteration, nodes int) {
+	e.lastLines = lines
+	e.reported = it
+	for i := range lines[:Min(len(lines), e.MultiPV.Val)] {
+		e.Update(e.lineInfo(lines[i], i+1, nodes))
+	}
+}
+
+func (e *Engine) lineInfo(line result, multiPV, nodes int) SearchInfo {
+	timeSinceStart := e.getElapsedTime()
+	return SearchInfo{
+		Score:    newUciScore(line.value),
+		WDL:      newWDL(line.value),
+		Depth:    line.depth,
+		SelDepth: line.seldepth,
+		Nodes:    nodes,
+		Nps:      int(float64(nodes) / timeSinceStart.Seconds()),
+		Duration: int(timeSinceStart.Milliseconds()),
+		Moves:    line.moves,
+		MultiPV:  multiPV,
+		HashFull: e.transTable.Hashfull(),
+		TbHits:   e.tbhits(),
+	}
+}
+
+func (t *thread) iterativeDeepening(moves []EvaledMove) {
+	mainThread := t.index == 0
+	lastValues := newLastValues(t.engine.multiPV())
 	// I do not think this matters much, but at the beginning only thread with id 0 have sorted moves list
 	if !mainThread {
 		rand.Shuffle(len(moves), func(i, j int) {
@@ -739,88 +837,140 @@ func (t *thread) iterativeDeepening(moves []EvaledMove, resultChan chan result,
 		})
 	}
 
-	for depth := 1; depth <= MAX_HEIGHT; depth++ {
-		res = t.aspirationWindow(depth, lastValue, moves)
-		resultChan <- res
-		lastValue = res.value
+	// Helpers cannot report iterations deeper than depth limit of main thread
+	lastDepth := MAX_HEIGHT
+	if t.engine.depthLimit > 0 {
+		lastDepth = Min(lastDepth, t.engine.depthLimit)
+	}
+	for depth := 1; depth <= lastDepth; depth++ {
+		if skipDepth(t.index, depth) {
+			continue
+		}
+		lines := t.rootSearch(depth, lastValues, moves)
+		if lines == nil {
+			return
+		}
+		t.setLines(depth, lines)
+		if mainThread && t.engine.isSearchFinished() {
+			return
+		}
 	}
 }
 
-func (e *Engine) bestMove(ctx context.Context, pos *Position) Move {
+// isSearchFinished reports best lines of all threads after iteration of main thread
+// and returns true if search should not be continued
+func (e *Engine) isSearchFinished() bool {
+	lines, it := e.bestLines()
+	depth := it.depth
+	res := lines[0]
+	nodes := e.nodes()
+	if e.reported != it {
+		e.updateLines(lines, it, nodes)
+	}
+	if res.value >= ValueWin && depthToMate(res.value) <= depth {
+		return true
+	}
+	if res.Move == NullMove || depth >= MAX_HEIGHT {
+		return true
+	}
+	e.updateTime(res.depth, res.value)
+	return e.isSoftTimeout(depth, nodes)
+}
+
+func (e *Engine) bestMove(ctx context.Context, pos *Position, searchMoves []Move) Move {
 	for i := range e.threads {
 		e.threads[i].stack[0].position = *pos
-		e.threads[i].nodes = 0
+		atomic.StoreInt64(&e.threads[i].nodes, 0)
+		atomic.StoreInt64(&e.threads[i].tbhits, 0)
+		e.threads[i].stopped = false
+		e.threads[i].setLines(0, nil)
 	}
 
 	rootMoves := GenerateAllLegalMoves(pos)
+	if len(searchMoves) > 0 {
+		rootMoves = filterRootMoves(rootMoves, searchMoves)
+	}
 
-	if fathom.IsDTZProbeable(pos) {
-		if ok, bestMove, wdl, dtz := fathom.ProbeDTZ(pos, rootMoves); ok {
+	if e.isTablebaseEnabled() && fathom.IsDTZProbeable(pos) {
+		if ok, bestMove, wdl, dtz := fathom.ProbeDTZ(pos, rootMoves); ok && (len(searchMoves) == 0 || containsMove(searchMoves, bestMove)) {
 			var score int
+			var tbWDL WDL
 			if wdl == fathom.TB_LOSS {
 				score = ValueLoss + dtz + 1
+				tbWDL.Loss = 1000
 			} else if wdl == fathom.TB_WIN {
 				score = ValueWin - dtz - 1
+				tbWDL.Win = 1000
 			} else {
 				score = 0
+				tbWDL.Draw = 1000
 			}
-			e.Update(SearchInfo{newUciScore(score), MAX_HEIGHT - 1, 0, 1, 0, []Move{bestMove}})
+			// Root probe is the only work done, so move is reported as search of depth 1
+			atomic.AddInt64(&e.threads[0].tbhits, 1)
+			info := e.lineInfo(result{Move: bestMove, value: score, depth: 1, seldepth: 1, moves: []Move{bestMove}}, 1, e.nodes())
+			info.WDL = tbWDL
+			e.Update(info)
 			return bestMove
 		}
 	}
 
 	ordMove := NullMove
-	if hashOk, _, _, _, hashMove, _ := transposition.GlobalTransTable.Get(pos.Key); hashOk {
+	if hashOk, _, _, _, hashMove, _ := e.transTable.Get(pos.Key); hashOk {
 		ordMove = hashMove
 	}
 	e.threads[0].EvaluateMoves(pos, rootMoves, ordMove, 0, 127)
 
 	sortMoves(rootMoves)
 
-	if e.Threads.Val == 1 {
-		return e.singleThreadBestMove(ctx, rootMoves)
+	// Helpers are stopped as soon as main thread finishes.
+	// Nodes limit stops only threads, so Search can still wait for ponderhit or stop.
+	ctx, stopHelpers := context.WithCancel(ctx)
+	e.done = ctx.Done()
+	e.stop = stopHelpers
+	// Results of helpers depend on scheduling of goroutines
+	if !e.Deterministic.Val {
+		e.startHelpers(rootMoves)
 	}
+	e.threads[0].iterativeDeepening(rootMoves)
+	stopHelpers()
+	e.waitHelpers()
 
-	resultChan := make(chan result)
-	for i := range e.threads {
-		go func(idx int) {
-			defer recoverFromTimeout()
-			e.threads[idx].iterativeDeepening(cloneEvaledMoves(rootMoves), resultChan, idx)
-		}(i)
+	// Helper could complete deeper iteration after the last report of main thread
+	lines, it := e.bestLines()
+	if lines == nil || lines[0].Move == NullMove {
+		return firstMove(rootMoves)
+	}
+	if e.reported != it {
+		e.updateLines(lines, it, e.nodes())
 	}
+	return lines[0].Move
+}
 
-	prevDepth := 0
-	var lastBestMove Move
-	for {
-		select {
-		case <-e.done:
-			// Hard timeout
-			return lastBestMove
-		case res := <-resultChan:
-			// If thread reports result for depth that is lower than already calculated one, ignore results
-			if res.depth <= prevDepth {
-				continue
-			}
-			nodes := e.nodes()
-			timeSinceStart := e.getElapsedTime()
-			e.Update(SearchInfo{newUciScore(res.value), res.depth, nodes, int(float64(nodes) / timeSinceStart.Seconds()), int(timeSinceStart.Milliseconds()), res.moves})
-			if res.value >= ValueWin && depthToMate(res.value) <= res.depth {
-				return res.Move
-			}
-			if res.Move == 0 {
-				return lastBestMove
-			}
-			if res.depth >= MAX_HEIGHT {
-				return res.Move
-			}
-			e.updateTime(res.depth, res.value)
-			if e.isSoftTimeout(res.depth, nodes) {
-				return res.Move
-			}
-			lastBestMove = res.Move
-			prevDepth = res.depth
+// Move returned when search was stopped before completing first iteration
+func firstMove(rootMoves []EvaledMove) Move {
+	if len(rootMoves) == 0 {
+		return NullMove
+	}
+	return rootMoves[0].Move
+}
+
+func filterRootMoves(rootMoves []EvaledMove, searchMoves []Move) []EvaledMove {
+	res := rootMoves[:0]
+	for _, move := range rootMoves {
+		if containsMove(searchMoves, move.Move) {
+			res = append(res, move)
 		}
 	}
+	return res
+}
+
+func containsMove(moves []Move, move Move) bool {
+	for _, m := range moves {
+		if m == move {
+			return true
+		}
+	}
+	return false
 }
 
 func cloneMoves(src []Move) []Move {
@@ -835,13 +985,6 @@ func cloneEvaledMoves(src []EvaledMove) []EvaledMove {
 	return dst
 }
 
-func recoverFromTimeout() {
-	err := recover()
-	if err != nil && err != errTimeout {
-		panic(err)
-	}
-}
-
 // Gaps from Best Increments for the Average Case of Shellsort, Marcin Ciura.
 var shellSortGaps = [...]int{23, 10, 4, 1}
 
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"math"
+
+	"github.com/mhib/combusken/backend"
+	. "github.com/mhib/combusken/utils"
+)
+
+const maxSkillLevel = 20
+
+// Ends of UCI_Elo range, mapped linearly onto skill levels.
+// They are estimates, not results of calibration matches, so UCI_Elo is only approximate.
+// Linear mapping assumes that every skill level adds the same number of Elo points.
+const minSkillElo = 1000
+const maxSkillElo = 2600
+
+// Number of root lines from which weakened engine chooses its move
+const skillMultiPV = 4
+
+// skillLevel returns level in [0, maxSkillLevel].
+// UCI_Elo takes precedence over Skill Level when UCI_LimitStrength is set.
+func (e *Engine) skillLevel() float64 {
+	if e.LimitStrength.Val {
+		return float64(e.Elo.Val-minSkillElo) * maxSkillLevel / (maxSkillElo - minSkillElo)
+	}
+	return float64(e.SkillLevel.Val)
+}
+
+func (e *Engine) isStrengthLimited() bool {
+	return e.skillLevel() < maxSkillLevel
+}
+
+// Weakened engine searches at least skillMultiPV lines, but reports only requested ones
+func (e *Engine) multiPV() int {
+	if e.isStrengthLimited() {
+		return Max(e.MultiPV.Val, skillMultiPV)
+	}
+	return e.MultiPV.Val
+}
+
+// limitStrength caps depth and nodes of search according to skill level
+func (e *Engine) limitStrength(limits LimitsType) (LimitsType, int) {
+	if !e.isStrengthLimited() {
+		return limits, 0
+	}
+	level := e.skillLevel()
+	maxDepth := 1 + int(level)
+	maxNodes := int(1000 * math.Pow(2, level/2))
+	if limits.Nodes == 0 || limits.Nodes > maxNodes {
+		limits.Nodes = maxNodes
+	}
+	if limits.Depth == 0 || limits.Depth > maxDepth {
+		limits.Depth = maxDepth
+	}
+	return limits, limits.Depth
+}
+
+// pickSkillMove chooses move among best lines of the last iteration.
+// Lower level makes worse moves and larger random noise more likely.
+// Idea from stockfish
+func (e *Engine) pickSkillMove(lines []result, bestMove backend.Move) backend.Move {
+	if len(lines) == 0 {
+		return bestMove
+	}
+	level := e.skillLevel()
+	weakness := 120 - int(2*level)
+	topScore := lines[0].value
+	delta := Min(topScore-lines[len(lines)-1].value, int(PawnValueMiddle))
+	maxScore := -Mate
+	for i := range lines {
+		push := (weakness*(topScore-lines[i].value) + delta*e.random.Intn(weakness)) / 128
+		if lines[i].value+push >= maxScore {
+			maxScore = lines[i].value + push
+			bestMove = lines[i].Move
+		}
+	}
+	return bestMove
+}
@@ -0,0 +1,82 @@
+// +build cgo
+
+package engine
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mhib/combusken/fathom"
+	"github.com/mhib/combusken/internal/testutil"
+)
+
+func TestSharedTablebases(t *testing.T) {
+	first, second := testutil.TablesDir(t, "KQvK.rtbw"), testutil.TablesDir(t, "KRPvK.rtbw")
+	e, err := New(map[string]string{"Hash": "16", "SyzygyPath": first})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fathom.MAX_PIECE_COUNT != 3 {
+		t.Errorf("tables were not loaded")
+	}
+	if _, err := New(map[string]string{"Hash": "16", "SyzygyPath": second}); err == nil {
+		t.Errorf("expected error for tablebases used by other engine")
+	}
+	other, err := New(map[string]string{"Hash": "16", "SyzygyPath": first})
+	if err != nil {
+		t.Fatalf("engines could not share tablebases: %v", err)
+	}
+	other.Close()
+	e.Close()
+	e, err = New(map[string]string{"Hash": "16", "SyzygyPath": second})
+	if err != nil {
+		t.Fatalf("tablebases were not released: %v", err)
+	}
+	if fathom.MAX_PIECE_COUNT != 4 {
+		t.Errorf("tables were not reloaded")
+	}
+	e.Close()
+}
+
+func TestMissingTablebases(t *testing.T) {
+	if _, err := New(map[string]string{"Hash": "16", "SyzygyPath": t.TempDir()}); err == nil {
+		t.Errorf("expected error for directory without tables")
+	}
+	e, err := New(map[string]string{"Hash": "16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	if err := e.SetOption("SyzygyPath", filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("expected error for missing directory")
+	}
+}
+
+func TestTablebasePathConflict(t *testing.T) {
+	first, second := testutil.TablesDir(t, "KQvK.rtbw"), testutil.TablesDir(t, "KRPvK.rtbw")
+	e, err := New(map[string]string{"Hash": "16", "SyzygyPath": first})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := New(map[string]string{"Hash": "16", "SyzygyPath": first})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if err := other.SetOption("SyzygyPath", second); err == nil {
+		t.Errorf("expected error for path different from the one used by other engine")
+	}
+	if other.TablebaseError() == nil || other.isTablebaseEnabled() {
+		t.Errorf("engine with conflicting path should be left without tablebases")
+	}
+	if !e.isTablebaseEnabled() || fathom.MAX_PIECE_COUNT != 3 {
+		t.Errorf("tablebases of other engine were changed")
+	}
+	e.Close()
+	if err := other.SetOption("SyzygyPath", second); err != nil {
+		t.Fatalf("path could not be changed after other engine released tables: %v", err)
+	}
+	if !other.isTablebaseEnabled() || fathom.MAX_PIECE_COUNT != 4 {
+		t.Errorf("tables were not reloaded")
+	}
+}
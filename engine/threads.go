@@ -0,0 +1,89 @@
+package engine
+
+import . "github.com/mhib/combusken/backend"
+
+// Helper threads skip depths in cycles of SMPCycles threads,
+// so that threads do not search the same depths at the same time
+var skipSize = [SMPCycles]int{1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 3, 3, 4, 4, 4, 4}
+var skipPhase = [SMPCycles]int{0, 1, 0, 1, 2, 3, 0, 1, 2, 3, 4, 5, 0, 1, 2, 3}
+
+// Main thread searches all depths
+func skipDepth(threadIdx, depth int) bool {
+	if threadIdx == 0 {
+		return false
+	}
+	cycle := (threadIdx - 1) % SMPCycles
+	return ((depth+skipPhase[cycle])/skipSize[cycle])%2 != 0
+}
+
+// Helper threads are run by long-lived goroutines that wait for root moves of the next search.
+// Main thread is run by goroutine that called Search.
+func (t *thread) run() {
+	for moves := range t.jobs {
+		t.iterativeDeepening(moves)
+		t.engine.helpers.Done()
+	}
+}
+
+func (e *Engine) resizeThreads(size int) {
+	e.closeHelpers()
+	threads := make([]thread, size)
+	for i := range threads {
+		threads[i].index = i
+		if i < len(e.threads) {
+			threads[i].MoveHistory = e.threads[i].MoveHistory
+		}
+	}
+	e.threads = threads
+	for i := 1; i < len(e.threads); i++ {
+		e.threads[i].jobs = make(chan []EvaledMove)
+		go e.threads[i].run()
+	}
+}
+
+func (e *Engine) closeHelpers() {
+	for i := 1; i < len(e.threads); i++ {
+		close(e.threads[i].jobs)
+	}
+}
+
+// Every helper searches its own copy of root moves
+func (e *Engine) startHelpers(rootMoves []EvaledMove) {
+	for i := 1; i < len(e.threads); i++ {
+		e.helpers.Add(1)
+		e.threads[i].jobs <- cloneEvaledMoves(rootMoves)
+	}
+}
+
+// Helpers stop when done is closed
+func (e *Engine) waitHelpers() {
+	e.helpers.Wait()
+}
+
+func (t *thread) setLines(depth int, lines []result) {
+	t.linesMu.Lock()
+	t.completedDepth = depth
+	t.lines = lines
+	t.linesMu.Unlock()
+}
+
+// iteration identifies lines of thread, as every thread completes each depth at most once in search
+type iteration struct {
+	thread int
+	depth  int
+}
+
+// bestLines returns lines of thread that completed the deepest iteration.
+// Threads that completed the same depth are compared by score.
+func (e *Engine) bestLines() (lines []result, best iteration) {
+	for i := range e.threads {
+		t := &e.threads[i]
+		t.linesMu.Lock()
+		if t.lines != nil && (lines == nil || t.completedDepth > best.depth ||
+			t.completedDepth == best.depth && t.lines[0].value > lines[0].value) {
+			lines, best = t.lines, iteration{i, t.completedDepth}
+		}
+		t.linesMu.Unlock()
+	}
+	return
+}
@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/mhib/combusken/backend"
+)
+
+func TestHelperThreads(t *testing.T) {
+	engine := NewEngine()
+	engine.Threads.Val = 3
+	engine.Hash.Val = 16
+	engine.NewGame()
+	defer engine.Close()
+	legalMoves := GenerateAllLegalMoves(&InitialPosition)
+	for i := 0; i < 2; i++ {
+		move := engine.Search(context.Background(), SearchParams{Positions: []Position{InitialPosition}, Limits: LimitsType{Depth: 8}})
+		if !containsEvaledMove(legalMoves, move) {
+			t.Fatalf("illegal move %v", move)
+		}
+		for idx := range engine.threads {
+			if engine.threads[idx].nodes == 0 {
+				t.Errorf("thread %d did not search", idx)
+			}
+		}
+		// Helpers must be stopped when search returns
+		nodes := engine.nodes()
+		time.Sleep(50 * time.Millisecond)
+		if engine.nodes() != nodes {
+			t.Errorf("helper threads are still searching")
+		}
+	}
+	for depth := 1; depth <= 4; depth++ {
+		if skipDepth(0, depth) {
+			t.Errorf("main thread skipped depth %d", depth)
+		}
+	}
+	if skipDepth(1, 1) == skipDepth(2, 1) {
+		t.Errorf("helpers search the same depths")
+	}
+}
+
+func TestHelpersDepthLimit(t *testing.T) {
+	engine := NewEngine()
+	engine.Threads.Val = 4
+	engine.Hash.Val = 16
+	engine.NewGame()
+	defer engine.Close()
+	var last SearchInfo
+	engine.Update = func(si SearchInfo) {
+		last = si
+	}
+	for depth := 1; depth <= 8; depth++ {
+		engine.Search(context.Background(), SearchParams{Positions: []Position{InitialPosition}, Limits: LimitsType{Depth: depth}})
+		if completed := engine.threads[0].completedDepth; completed != depth {
+			t.Errorf("go depth %d: main thread completed depth %d", depth, completed)
+		}
+		for idx := range engine.threads {
+			if completed := engine.threads[idx].completedDepth; completed > depth {
+				t.Errorf("go depth %d: thread %d completed depth %d", depth, idx, completed)
+			}
+		}
+		lines, it := engine.bestLines()
+		if it.depth != depth || engine.reported != it {
+			t.Errorf("go depth %d: reported iteration %+v, best iteration %+v", depth, engine.reported, it)
+		}
+		// Line of the last iteration is searched with lower depth for every fail high of aspiration window,
+		// so reported depth is compared with depth of that search
+		if lines[0].depth < 1 || lines[0].depth > depth || last.Depth != lines[0].depth {
+			t.Errorf("go depth %d: reported depth %d, line searched with depth %d", depth, last.Depth, lines[0].depth)
+		}
+	}
+}
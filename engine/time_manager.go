@@ -1,6 +1,7 @@
 package engine
 
 import "time"
+import "sync/atomic"
 import . "github.com/mhib/combusken/backend"
 import . "github.com/mhib/combusken/utils"
 
@@ -36,8 +37,7 @@ func (manager *depthMoveTimeManager) isSoftTimeout(depth, nodes int) bool {
 	return manager.depth > 0 && depth >= manager.depth
 }
 
-func (manager *depthMoveTimeManager) updateTime(int, int) {
-}
+func (manager *depthMoveTimeManager) updateTime(int, int) {}
 
 type tournamentTimeManager struct {
 	timeElapser
@@ -102,11 +102,91 @@ func newTournamentTimeManager(startedAt time.Time, limits LimitsType, overhead,
 	return res
 }
 
-func newTimeManager(limits LimitsType, overhead int, sideToMove int) timeManager {
+// ponderTimeManager never stops search before ponderhit.
+// After ponderhit it behaves like wrapped time manager,
+// which started counting time when pondering started.
+type ponderTimeManager struct {
+	timeManager
+	hit     int32
+	hitChan chan struct{}
+}
+
+func (manager *ponderTimeManager) hardTimeout() time.Duration {
+	return 0
+}
+
+func (manager *ponderTimeManager) isSoftTimeout(depth, nodes int) bool {
+	return manager.isPonderHit() && manager.timeManager.isSoftTimeout(depth, nodes)
+}
+
+func (manager *ponderTimeManager) isPonderHit() bool {
+	return atomic.LoadInt32(&manager.hit) != 0
+}
+
+func (manager *ponderTimeManager) ponderHit() {
+	atomic.StoreInt32(&manager.hit, 1)
+	close(manager.hitChan)
+}
+
+// depthLimitTimeManager stops search of wrapped time manager after maxDepth
+type depthLimitTimeManager struct {
+	timeManager
+	maxDepth int
+}
+
+func (manager *depthLimitTimeManager) isSoftTimeout(depth, nodes int) bool {
+	return depth >= manager.maxDepth || manager.timeManager.isSoftTimeout(depth, nodes)
+}
+
+// searchLimitTimeManager stops search of wrapped time manager after nodes limit
+// or as soon as mate in requested number of moves or better is found
+type searchLimitTimeManager struct {
+	timeManager
+	nodes     int
+	mate      int
+	mateFound bool
+}
+
+func (manager *searchLimitTimeManager) isSoftTimeout(depth, nodes int) bool {
+	return (manager.nodes > 0 && nodes >= manager.nodes) ||
+		manager.mateFound ||
+		manager.timeManager.isSoftTimeout(depth, nodes)
+}
+
+func (manager *searchLimitTimeManager) updateTime(depth, score int) {
+	manager.timeManager.updateTime(depth, score)
+	if manager.mate > 0 && score >= ValueWin && (depthToMate(score)+1)/2 <= manager.mate {
+		manager.mateFound = true
+	}
+}
+
+// Nodes and mate limits apply to every time control.
+// If maxDepth is positive search is stopped after it regardless of time control,
+// also during pondering. Stopped pondering search still waits for ponderhit.
+func newTimeManager(limits LimitsType, maxDepth, overhead int, sideToMove int) timeManager {
 	startedAt := time.Now()
+	var manager timeManager
 	if limits.WhiteTime > 0 || limits.BlackTime > 0 {
-		return newTournamentTimeManager(startedAt, limits, overhead, sideToMove)
+		manager = newTournamentTimeManager(startedAt, limits, overhead, sideToMove)
 	} else {
-		return &depthMoveTimeManager{timeElapser{startedAt: startedAt}, limits.MoveTime, limits.Depth}
+		manager = &depthMoveTimeManager{timeElapser: timeElapser{startedAt: startedAt}, duration: limits.MoveTime, depth: limits.Depth}
+	}
+	if limits.Nodes > 0 || limits.Mate > 0 {
+		manager = &searchLimitTimeManager{timeManager: manager, nodes: limits.Nodes, mate: limits.Mate}
+	}
+	if limits.Ponder {
+		manager = &ponderTimeManager{timeManager: manager, hitChan: make(chan struct{})}
+	}
+	if maxDepth > 0 {
+		manager = &depthLimitTimeManager{timeManager: manager, maxDepth: maxDepth}
+	}
+	return manager
+}
+
+func findPonderManager(manager timeManager) (*ponderTimeManager, bool) {
+	if limited, ok := manager.(*depthLimitTimeManager); ok {
+		manager = limited.timeManager
 	}
+	ponderManager, ok := manager.(*ponderTimeManager)
+	return ponderManager, ok
 }
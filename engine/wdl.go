@@ -0,0 +1,39 @@
+package engine
+
+import "math"
+
+// Parameters of win/draw/loss model.
+// Probability of win is the same logistic function of evaluation as in tuning,
+// shifted by margin in which game is likely to end in a draw.
+// They are fit to results of games with `combusken fit-wdl`, which scores positions by search like UCI info,
+// current values to 1500 self-play games at 10000 nodes per move.
+const WDLScale = 0.8694
+const WDLDrawMargin = 169
+
+// WDL holds permill estimates of game result from side to move perspective
+type WDL struct {
+	Win  int
+	Draw int
+	Loss int
+}
+
+func newWDL(score int) WDL {
+	// Mate and tablebase scores
+	if score >= ValueWin-MAX_HEIGHT {
+		return WDL{Win: 1000}
+	} else if score <= ValueLoss+MAX_HEIGHT {
+		return WDL{Loss: 1000}
+	}
+	win := winPermill(score)
+	loss := winPermill(-score)
+	return WDL{win, 1000 - win - loss, loss}
+}
+
+func winPermill(score int) int {
+	return int(math.Round(1000 * WinProbability(WDLScale, WDLDrawMargin, float64(score))))
+}
+
+// WinProbability returns probability of win in position evaluated with score
+func WinProbability(scale, drawMargin, score float64) float64 {
+	return 1.0 / (1.0 + math.Pow(10.0, -scale*(score-drawMargin)/400.0))
+}
@@ -391,9 +391,9 @@ func IsLateEndGame(pos *Position) bool {
 	return ((pos.Pieces[Rook] | pos.Pieces[Queen] | pos.Pieces[Bishop] | pos.Pieces[Knight]) & pos.Colours[pos.SideToMove]) == 0
 }
 
-func evaluateKingPawns(pos *Position) Score {
-	if !tuning {
-		if ok, score := GlobalPawnKingTable.Get(pos.PawnKey); ok {
+func evaluateKingPawns(pos *Position, pkTable *PawnKingTable) Score {
+	if !tuning && pkTable != nil {
+		if ok, score := pkTable.Get(pos.PawnKey); ok {
 			return score
 		}
 	}
@@ -594,13 +594,15 @@ func evaluateKingPawns(pos *Position) Score {
 			T.KingStorm[blocked][FileMirror[file]][theirDist]--
 		}
 	}
-	if !tuning {
-		GlobalPawnKingTable.Set(pos.PawnKey, score)
+	if !tuning && pkTable != nil {
+		pkTable.Set(pos.PawnKey, score)
 	}
 	return score
 }
 
-func Evaluate(pos *Position) int {
+// Evaluate returns evaluation of position from side to move perspective.
+// Pawn and king scores are cached in pkTable if it is not nil.
+func Evaluate(pos *Position, pkTable *PawnKingTable) int {
 	var fromId int
 	var fromBB uint64
 	var attacks uint64
@@ -649,7 +651,7 @@ func Evaluate(pos *Position) int {
 	blackAttackedBy[Pawn] |= attacks
 	blackKingAttacksCount += int16(PopCount(attacks & whiteKingArea))
 
-	score := evaluateKingPawns(pos)
+	score := evaluateKingPawns(pos, pkTable)
 
 	// white knights
 	for fromBB = pos.Pieces[Knight] & pos.Colours[White]; fromBB != 0; fromBB &= (fromBB - 1) {
@@ -1,16 +1,17 @@
 package evaluation
 
 import (
+	"sync/atomic"
 	"unsafe"
 
 	. "github.com/mhib/combusken/utils"
 )
 
-var GlobalPawnKingTable PawnKingTable
-
+// PKTableEntry is shared by search threads without locks.
+// Key is stored xored with data, so entry torn by concurrent writes does not match any key.
 type PKTableEntry struct {
-	key   uint64
-	score Score
+	key  uint64
+	data uint64
 }
 
 type PawnKingTable struct {
@@ -25,18 +26,20 @@ func NewPawnKingTable(megabytes int) PawnKingTable {
 
 func (t *PawnKingTable) Get(key uint64) (ok bool, score Score) {
 	var element = &t.Entries[key&t.Mask]
-	if element.key != key {
+	data := atomic.LoadUint64(&element.data)
+	if atomic.LoadUint64(&element.key)^data != key {
 		return
 	}
 	ok = true
-	score = element.score
+	score = Score(int32(uint32(data)))
 	return
 }
 
 func (t *PawnKingTable) Set(key uint64, score Score) {
 	var element = &t.Entries[key&t.Mask]
-	element.key = key
-	element.score = score
+	data := uint64(uint32(score))
+	atomic.StoreUint64(&element.key, key^data)
+	atomic.StoreUint64(&element.data, data)
 }
 
 func (t *PawnKingTable) Clear() {
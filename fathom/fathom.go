@@ -8,16 +8,70 @@ package fathom
 import "C"
 import "unsafe"
 import "github.com/mhib/combusken/backend"
+import "fmt"
 import "strings"
+import "sync"
 
 var MAX_PIECE_COUNT = 0
-var MIN_PROBE_DEPTH = 0
 
-func SetPath(path string) {
-	cPath := C.CString(strings.TrimSpace(path))
+// Fathom keeps loaded tables in global state, so all engines of the process share one path.
+// Tables are loaded by the first user of the path and freed when the last one releases them.
+var pathMutex sync.Mutex
+var currentPath string
+var users int
+
+// Acquire loads tablebases from path or shares tables already loaded from it.
+// It fails when no tables are found in path, or when other engine uses tables from different path,
+// as reloading them would change tables used in its search.
+func Acquire(path string) error {
+	path = strings.TrimSpace(path)
+	pathMutex.Lock()
+	defer pathMutex.Unlock()
+	if users > 0 {
+		if path != currentPath {
+			return fmt.Errorf("tablebases from %v are used by other engine", currentPath)
+		}
+		users++
+		return nil
+	}
+	if !initTables(path) {
+		initTables("")
+		return fmt.Errorf("could not initialize tablebases from %v", path)
+	}
+	if MAX_PIECE_COUNT == 0 {
+		initTables("")
+		return fmt.Errorf("no tablebases found in %v", path)
+	}
+	currentPath = path
+	users = 1
+	return nil
+}
+
+// Release frees tablebases after their last user releases them
+func Release() {
+	pathMutex.Lock()
+	defer pathMutex.Unlock()
+	if users == 0 {
+		return
+	}
+	users--
+	if users == 0 {
+		currentPath = ""
+		initTables("")
+	}
+}
+
+// Initialization with empty path unloads tables, but unlike tb_free allows loading them again
+func initTables(path string) bool {
+	cPath := C.CString(path)
 	defer C.free(unsafe.Pointer(cPath))
-	C.tb_init(cPath)
+	ok := C.tb_init(cPath)
+	if path == "" {
+		// tb_init returns before resetting largest table size
+		C.TB_LARGEST = 0
+	}
 	MAX_PIECE_COUNT = int(C.TB_LARGEST)
+	return bool(ok)
 }
 
 func Clear() {
@@ -41,17 +95,17 @@ func ProbeWDL(pos *backend.Position, depth int) int64 {
 	))
 }
 
-func IsWDLProbeable(pos *backend.Position, depth int) bool {
+func IsWDLProbeable(pos *backend.Position, depth, minProbeDepth int) bool {
 	return MAX_PIECE_COUNT != 0 &&
 		pos.FiftyMove == 0 &&
 		pos.EpSquare == 0 &&
 		pos.Flags == 0xF &&
-		depthCardinalityCheck(pos, depth)
+		depthCardinalityCheck(pos, depth, minProbeDepth)
 }
 
-func depthCardinalityCheck(pos *backend.Position, depth int) bool {
+func depthCardinalityCheck(pos *backend.Position, depth, minProbeDepth int) bool {
 	cardinality := backend.PopCount(pos.Colours[backend.White] | pos.Colours[backend.Black])
-	return cardinality < MAX_PIECE_COUNT || (cardinality == MAX_PIECE_COUNT && depth >= MIN_PROBE_DEPTH)
+	return cardinality < MAX_PIECE_COUNT || (cardinality == MAX_PIECE_COUNT && depth >= minProbeDepth)
 }
 
 func IsDTZProbeable(pos *backend.Position) bool {
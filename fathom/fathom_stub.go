@@ -2,12 +2,19 @@
 
 package fathom
 
-import "github.com/mhib/combusken/backend"
+import (
+	"errors"
+
+	"github.com/mhib/combusken/backend"
+)
 
 var MAX_PIECE_COUNT = 0
-var MIN_PROBE_DEPTH = 0
 
-func SetPath(path string) {
+func Acquire(path string) error {
+	return errors.New("tablebases are not supported in build without cgo")
+}
+
+func Release() {
 }
 
 func Clear() {
@@ -17,7 +24,7 @@ func ProbeWDL(pos *backend.Position, depth int) int64 {
 	return 0
 }
 
-func IsWDLProbeable(pos *backend.Position, depth int) bool {
+func IsWDLProbeable(pos *backend.Position, depth, minProbeDepth int) bool {
 	return false
 }
 
@@ -0,0 +1,56 @@
+// +build cgo
+
+package fathom
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mhib/combusken/internal/testutil"
+)
+
+func TestMissingTables(t *testing.T) {
+	for _, path := range []string{t.TempDir(), filepath.Join(t.TempDir(), "missing")} {
+		if err := Acquire(path); err == nil {
+			Release()
+			t.Errorf("expected error for %v", path)
+		}
+		if MAX_PIECE_COUNT != 0 {
+			t.Errorf("tables were left loaded after failure")
+		}
+	}
+}
+
+func TestSharedPath(t *testing.T) {
+	first, second := testutil.TablesDir(t, "KQvK.rtbw", "KQvK.rtbz"), testutil.TablesDir(t, "KRPvK.rtbw")
+	if err := Acquire(first); err != nil {
+		t.Fatal(err)
+	}
+	if MAX_PIECE_COUNT != 3 {
+		t.Errorf("expected 3 piece tables, got %v", MAX_PIECE_COUNT)
+	}
+	if err := Acquire(second); err == nil {
+		t.Errorf("tables were reloaded while in use")
+	}
+	if err := Acquire(first); err != nil {
+		t.Errorf("same path could not be shared: %v", err)
+	}
+	Release()
+	if err := Acquire(second); err == nil {
+		t.Errorf("tables were reloaded before last user released them")
+	}
+	if MAX_PIECE_COUNT != 3 {
+		t.Errorf("tables in use were changed, got %v piece tables", MAX_PIECE_COUNT)
+	}
+	Release()
+	if MAX_PIECE_COUNT != 0 {
+		t.Errorf("tables were not unloaded after release")
+	}
+	if err := Acquire(second); err != nil {
+		t.Errorf("path could not be changed after release: %v", err)
+	}
+	if MAX_PIECE_COUNT != 4 {
+		t.Errorf("expected 4 piece tables, got %v", MAX_PIECE_COUNT)
+	}
+	Release()
+}
@@ -0,0 +1,21 @@
+// Package testutil contains fixtures shared by tests of several packages
+package testutil
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// TablesDir creates temporary directory with Syzygy tables of given names.
+// Tables are only validated by size when initialized, data is read on first probe,
+// so empty files are enough to load them.
+func TablesDir(t testing.TB, names ...string) string {
+	dir := t.TempDir()
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), make([]byte, 16), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
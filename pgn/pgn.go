@@ -0,0 +1,108 @@
+// Package pgn reads and writes games in Portable Game Notation
+package pgn
+
+import "github.com/mhib/combusken/backend"
+
+const (
+	WhiteWins = "1-0"
+	BlackWins = "0-1"
+	Draw      = "1/2-1/2"
+	Unknown   = "*"
+)
+
+// Seven Tag Roster, written in this order before other tags
+var sevenTagRoster = [...]string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+type Tag struct {
+	Name  string
+	Value string
+}
+
+// Node is a single half move with its annotations.
+// Variations are alternatives to this move, played from the same position.
+type Node struct {
+	Move backend.Move
+	// SAN in export format, Writer converts Move again
+	SAN string
+	// Comment placed before the first move of variation
+	CommentBefore string
+	Comment       string
+	NAGs          []int
+	Variations    [][]Node
+}
+
+type Game struct {
+	Tags []Tag
+	// Comment placed before the first move
+	Comment string
+	Start   backend.Position
+	Moves   []Node
+	Result  string
+
+	// Position after the first endPly main line moves,
+	// so that AddMove does not replay the whole game
+	end      backend.Position
+	endPly   int
+	hasEnd   bool
+	endStart uint64
+}
+
+func NewGame() *Game {
+	return &Game{Start: backend.InitialPosition, Result: Unknown}
+}
+
+// Tag returns value of tag or empty string if game does not have it
+func (g *Game) Tag(name string) string {
+	for _, tag := range g.Tags {
+		if tag.Name == name {
+			return tag.Value
+		}
+	}
+	return ""
+}
+
+// SetTag overwrites value of existing tag or appends a new one
+func (g *Game) SetTag(name, value string) {
+	for i := range g.Tags {
+		if g.Tags[i].Name == name {
+			g.Tags[i].Value = value
+			return
+		}
+	}
+	g.Tags = append(g.Tags, Tag{name, value})
+}
+
+// Positions returns start position followed by positions after each main line move
+func (g *Game) Positions() []backend.Position {
+	res := make([]backend.Position, 1, len(g.Moves)+1)
+	res[0] = g.Start
+	for _, node := range g.Moves {
+		var child backend.Position
+		res[len(res)-1].MakeLegalMove(node.Move, &child)
+		res = append(res, child)
+	}
+	return res
+}
+
+// AddMove appends move to main line, move is expected to be legal in the last position
+func (g *Game) AddMove(move backend.Move) {
+	pos := g.endPosition()
+	g.Moves = append(g.Moves, Node{Move: move, SAN: pos.ToSAN(move)})
+	pos.MakeLegalMove(move, &g.end)
+	g.endPly++
+}
+
+// endPosition returns position after main line.
+// Cached position is replayed from the start only if main line was changed other than by AddMove.
+func (g *Game) endPosition() backend.Position {
+	if !g.hasEnd || g.endStart != g.Start.Key || g.endPly > len(g.Moves) ||
+		g.endPly > 0 && g.Moves[g.endPly-1].Move != g.end.LastMove {
+		g.end, g.endPly, g.hasEnd, g.endStart = g.Start, 0, true, g.Start.Key
+	}
+	for ; g.endPly < len(g.Moves); g.endPly++ {
+		var child backend.Position
+		g.end.MakeLegalMove(g.Moves[g.endPly].Move, &child)
+		g.end = child
+	}
+	return g.end
+}
@@ -0,0 +1,219 @@
+package pgn
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mhib/combusken/backend"
+)
+
+const testPGN = `[Event "Test"]
+[Site "Somewhere"]
+[Date "2020.01.01"]
+[Round "1"]
+[White "Combusken"]
+[Black "Opponent \"quoted\""]
+[Result "1-0"]
+[WhiteElo "2800"]
+
+{Opening comment} 1. e4 e5 2. Nf3 {main line} (2. f4 exf4 ({Countergambit} 2... d5) 3. Nf3) 2... Nc6 3. Bb5 $1 a6?!
+4. Ba4 Nf6 5.O-O ; line comment
+Be7 1-0
+
+% escaped line
+[Event "Second"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 w - - 0 40"]
+
+40. e4 Kd7 41. e5 *
+
+[Event "Broken"]
+
+1. e4 e4 2. d4 1-0
+
+1. d4 d5 1/2-1/2
+`
+
+func TestReader(t *testing.T) {
+	reader := NewReader(strings.NewReader(testPGN))
+
+	game, err := reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Tag("Black") != `Opponent "quoted"` || game.Tag("WhiteElo") != "2800" || game.Result != WhiteWins {
+		t.Errorf("invalid tags %v", game.Tags)
+	}
+	if game.Comment != "Opening comment" {
+		t.Errorf("invalid game comment %q", game.Comment)
+	}
+	expected := []string{"e4", "e5", "Nf3", "Nc6", "Bb5", "a6", "Ba4", "Nf6", "O-O", "Be7"}
+	if len(game.Moves) != len(expected) {
+		t.Fatalf("expected %d moves, got %d", len(expected), len(game.Moves))
+	}
+	for i, node := range game.Moves {
+		if node.SAN != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], node.SAN)
+		}
+	}
+	if game.Moves[2].Comment != "main line" || len(game.Moves[2].Variations) != 1 || game.Moves[8].Comment != "line comment" {
+		t.Errorf("invalid annotations of %v", game.Moves[2])
+	}
+	variation := game.Moves[2].Variations[0]
+	if len(variation) != 3 || len(variation[1].Variations) != 1 || variation[1].Variations[0][0].SAN != "d5" {
+		t.Errorf("invalid variation %v", variation)
+	}
+	if variation[1].Variations[0][0].CommentBefore != "Countergambit" || variation[0].CommentBefore != "" {
+		t.Errorf("invalid comment at the start of variation %v", variation)
+	}
+	if len(game.Moves[4].NAGs) != 1 || game.Moves[4].NAGs[0] != 1 || game.Moves[5].NAGs[0] != 6 {
+		t.Errorf("invalid NAGs")
+	}
+	positions := game.Positions()
+	if fen := positions[len(positions)-1].Fen(); fen != "r1bqk2r/1pppbppp/p1n2n2/4p3/B3P3/5N2/PPPP1PPP/RNBQ1RK1 w kq - 4 6" {
+		t.Errorf("invalid final position %v", fen)
+	}
+
+	game, err = reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(game.Moves) != 3 || game.Result != Unknown || game.Start.FullMove != 40 {
+		t.Errorf("invalid game from FEN %v", game)
+	}
+
+	if _, err = reader.Next(); !isParseError(err) {
+		t.Errorf("expected parse error for illegal move, got %v", err)
+	}
+
+	game, err = reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(game.Moves) != 2 || game.Result != Draw {
+		t.Errorf("invalid game after broken one %v", game)
+	}
+
+	if _, err = reader.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestReaderError(t *testing.T) {
+	reader := NewReader(io.MultiReader(strings.NewReader("[Event \"Broken\"]\n1. e4 e5 2. Nf"), failingReader{}))
+	if _, err := reader.Next(); err == nil || isParseError(err) {
+		t.Errorf("expected error of underlying reader, got %v", err)
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	reader := NewReader(strings.NewReader(testPGN))
+	var games []*Game
+	for i := 0; i < 2; i++ {
+		game, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		games = append(games, game)
+	}
+
+	var buffer bytes.Buffer
+	writer := NewWriter(&buffer)
+	for _, game := range games {
+		if err := writer.Write(game); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, line := range strings.Split(buffer.String(), "\n") {
+		if len(line) > maxLineLength {
+			t.Errorf("line too long: %v", line)
+		}
+	}
+	written := buffer.String()
+	expected := "{Opening comment} 1. e4 e5 2. Nf3 {main line} (2. f4 exf4 ({Countergambit} 2... d5) 3. Nf3) " +
+		"2... Nc6 3. Bb5 $1 a6 $6 4. Ba4 Nf6 5. O-O {line comment} 5... Be7 1-0"
+	if movetext := strings.Join(strings.Fields(strings.SplitN(written, "\n\n", 2)[1]), " "); !strings.HasPrefix(movetext, expected+" ") {
+		t.Errorf("expected movetext:\n%v\ngot:\n%v", expected, written)
+	}
+
+	// Games read back are written the same
+	reader = NewReader(strings.NewReader(written))
+	var rewritten bytes.Buffer
+	writer = NewWriter(&rewritten)
+	for range games {
+		game, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Write(game); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rewritten.String() != written {
+		t.Errorf("games changed after round trip:\n%v\nexpected:\n%v", rewritten.String(), written)
+	}
+}
+
+func TestAddMove(t *testing.T) {
+	game := NewGame()
+	pos := backend.InitialPosition
+	for _, lan := range []string{"g1f3", "d7d5"} {
+		pos, _ = pos.MakeMoveLAN(lan)
+		game.AddMove(pos.LastMove)
+	}
+	var buffer bytes.Buffer
+	if err := NewWriter(&buffer).Write(game); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(buffer.String(), "\n1. Nf3 d5 *\n\n") {
+		t.Errorf("invalid output:\n%v", buffer.String())
+	}
+
+	// Main line replaced without AddMove
+	game.Moves = game.Moves[:1]
+	pos, _ = backend.InitialPosition.MakeMoveLAN("g1f3")
+	pos, _ = pos.MakeMoveLAN("g8f6")
+	game.AddMove(pos.LastMove)
+	if san := game.Moves[len(game.Moves)-1].SAN; san != "Nf6" {
+		t.Errorf("expected Nf6, got %v", san)
+	}
+}
+
+func TestWriterCanonicalSAN(t *testing.T) {
+	const input = `[Event "Non canonical"]
+
+1. e4 e5 2. Ngf3 Nb8c6 3. Bc4 Ng8f6 4. 0-0 Bc5 *
+
+[Event "Promotion"]
+[FEN "8/4P3/8/8/8/8/k7/4K3 w - - 0 1"]
+
+1. e8Q Kb2 *
+`
+	reader := NewReader(strings.NewReader(input))
+	var buffer bytes.Buffer
+	writer := NewWriter(&buffer)
+	for i := 0; i < 2; i++ {
+		game, err := reader.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Write(game); err != nil {
+			t.Fatal(err)
+		}
+	}
+	output := strings.Join(strings.Fields(buffer.String()), " ")
+	for _, expected := range []string{"1. e4 e5 2. Nf3 Nc6 3. Bc4 Nf6 4. O-O Bc5 *", "1. e8=Q Kb2 *"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in output:\n%v", expected, buffer.String())
+		}
+	}
+}
@@ -0,0 +1,405 @@
+package pgn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mhib/combusken/backend"
+)
+
+const (
+	tokenEOF = iota
+	tokenTag
+	tokenComment
+	tokenVariationStart
+	tokenVariationEnd
+	tokenNAG
+	tokenResult
+	tokenSymbol
+)
+
+type token struct {
+	kind  int
+	value string
+	// Used only by tags
+	name string
+}
+
+// Suffix annotations are translated to their NAG equivalents
+var suffixAnnotations = map[string]int{"!": 1, "?": 2, "!!": 3, "??": 4, "!?": 5, "?!": 6}
+
+// Reader reads games one by one from PGN stream
+type Reader struct {
+	r           *bufio.Reader
+	pending     *token
+	line        int
+	atLineStart bool
+	games       int
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, 1<<16), line: 1, atLineStart: true}
+}
+
+// ParseError is returned by Next for malformed game
+type ParseError struct {
+	Game int
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("pgn: game %d, line %d: %v", e.Game, e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func (r *Reader) parseError(format string, args ...interface{}) error {
+	return &ParseError{Game: r.games, Line: r.line, Err: fmt.Errorf(format, args...)}
+}
+
+func isParseError(err error) bool {
+	_, ok := err.(*ParseError)
+	return ok
+}
+
+// Next returns next game from stream or io.EOF when there are no more games.
+// If game is malformed, the rest of it is skipped and *ParseError is returned,
+// so reading can be continued with next call.
+// Errors of underlying reader are returned as they are and reading should not be continued.
+func (r *Reader) Next() (*Game, error) {
+	game := NewGame()
+	tok, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	if tok.kind == tokenEOF {
+		return nil, io.EOF
+	}
+	r.games++
+	for tok.kind == tokenTag {
+		game.SetTag(tok.name, tok.value)
+		if tok, err = r.next(); err != nil {
+			return nil, r.skipGame(err)
+		}
+	}
+	r.unread(tok)
+
+	if fen := game.Tag("FEN"); fen != "" {
+		if game.Start, err = backend.ParseFenStrict(fen); err != nil {
+			return nil, r.skipGame(r.parseError("%v", err))
+		}
+	}
+	if result := game.Tag("Result"); result != "" {
+		game.Result = result
+	}
+
+	moves, result, err := r.parseLine(game, game.Start, true)
+	if err != nil {
+		return nil, r.skipGame(err)
+	}
+	game.Moves = moves
+	if result != "" {
+		game.Result = result
+	}
+	return game, nil
+}
+
+// parseLine parses main line or variation starting from pos
+func (r *Reader) parseLine(game *Game, pos backend.Position, mainLine bool) (nodes []Node, result string, err error) {
+	var previous backend.Position
+	// Comment at the start of variation, attached to its first move
+	var commentBefore string
+	for {
+		tok, err := r.next()
+		if err != nil {
+			return nil, "", err
+		}
+		switch tok.kind {
+		case tokenEOF, tokenTag:
+			if !mainLine {
+				return nil, "", r.parseError("unterminated variation")
+			}
+			// Game without result token
+			r.unread(tok)
+			return nodes, "", nil
+		case tokenResult:
+			if !mainLine {
+				return nil, "", r.parseError("result inside variation")
+			}
+			return nodes, tok.value, nil
+		case tokenVariationEnd:
+			if mainLine {
+				return nil, "", r.parseError("unexpected end of variation")
+			}
+			return nodes, "", nil
+		case tokenVariationStart:
+			if len(nodes) == 0 {
+				return nil, "", r.parseError("variation before first move")
+			}
+			variation, _, err := r.parseLine(game, previous, false)
+			if err != nil {
+				return nil, "", err
+			}
+			last := &nodes[len(nodes)-1]
+			last.Variations = append(last.Variations, variation)
+		case tokenComment:
+			if len(nodes) > 0 {
+				nodes[len(nodes)-1].Comment = joinComments(nodes[len(nodes)-1].Comment, tok.value)
+			} else if mainLine {
+				game.Comment = joinComments(game.Comment, tok.value)
+			} else {
+				commentBefore = joinComments(commentBefore, tok.value)
+			}
+		case tokenNAG:
+			if len(nodes) == 0 {
+				continue
+			}
+			nag, err := strconv.Atoi(tok.value)
+			if err != nil {
+				return nil, "", r.parseError("invalid NAG %q", tok.value)
+			}
+			nodes[len(nodes)-1].NAGs = append(nodes[len(nodes)-1].NAGs, nag)
+		case tokenSymbol:
+			symbol := stripMoveNumber(tok.value)
+			if symbol == "" {
+				continue
+			}
+			san, nag := splitSuffixAnnotation(symbol)
+			move, ok := pos.ParseMoveSAN(san)
+			if !ok {
+				return nil, "", r.parseError("illegal move %q in position %v", tok.value, pos.Fen())
+			}
+			node := Node{Move: move, SAN: pos.ToSAN(move)}
+			if len(nodes) == 0 {
+				node.CommentBefore = commentBefore
+			}
+			if nag != 0 {
+				node.NAGs = append(node.NAGs, nag)
+			}
+			nodes = append(nodes, node)
+			previous = pos
+			previous.MakeLegalMove(move, &pos)
+		}
+	}
+}
+
+// skipGame skips tokens until the end of current game after parse error.
+// Other errors are returned immediately.
+func (r *Reader) skipGame(err error) error {
+	if !isParseError(err) {
+		return err
+	}
+	for {
+		tok, readErr := r.next()
+		if isParseError(readErr) {
+			continue
+		} else if readErr != nil {
+			return readErr
+		}
+		switch tok.kind {
+		case tokenResult, tokenEOF:
+			return err
+		case tokenTag:
+			r.unread(tok)
+			return err
+		}
+	}
+}
+
+func joinComments(left, right string) string {
+	if left == "" {
+		return right
+	}
+	return left + " " + right
+}
+
+// Move numbers can be glued to moves, e.g. "12.e4" or "12...e5"
+func stripMoveNumber(symbol string) string {
+	idx := 0
+	for idx < len(symbol) && symbol[idx] >= '0' && symbol[idx] <= '9' {
+		idx++
+	}
+	if idx < len(symbol) && symbol[idx] != '.' {
+		return symbol
+	}
+	for idx < len(symbol) && symbol[idx] == '.' {
+		idx++
+	}
+	return symbol[idx:]
+}
+
+func splitSuffixAnnotation(symbol string) (string, int) {
+	idx := strings.IndexAny(symbol, "!?")
+	if idx == -1 {
+		return symbol, 0
+	}
+	return symbol[:idx], suffixAnnotations[symbol[idx:]]
+}
+
+func (r *Reader) unread(tok token) {
+	r.pending = &tok
+}
+
+func (r *Reader) readByte() (byte, error) {
+	c, err := r.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if c == '\n' {
+		r.line++
+		r.atLineStart = true
+	} else {
+		r.atLineStart = false
+	}
+	return c, nil
+}
+
+func (r *Reader) unreadByte() {
+	r.r.UnreadByte()
+}
+
+func isSymbolByte(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+		strings.IndexByte("_+#=:-/.!?", c) != -1
+}
+
+func (r *Reader) next() (token, error) {
+	if r.pending != nil {
+		tok := *r.pending
+		r.pending = nil
+		return tok, nil
+	}
+	for {
+		atLineStart := r.atLineStart
+		c, err := r.readByte()
+		if err == io.EOF {
+			return token{kind: tokenEOF}, nil
+		} else if err != nil {
+			return token{}, err
+		}
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			continue
+		case c == '%' && atLineStart:
+			if _, err := r.readUntil('\n'); err == io.EOF {
+				return token{kind: tokenEOF}, nil
+			} else if err != nil {
+				return token{}, err
+			}
+		case c == ';':
+			// Rest of line comment, file can end without newline
+			comment, err := r.readUntil('\n')
+			if err != nil && err != io.EOF {
+				return token{}, err
+			}
+			return token{kind: tokenComment, value: strings.Join(strings.Fields(comment), " ")}, nil
+		case c == '[':
+			return r.readTag()
+		case c == '{':
+			comment, err := r.readUntil('}')
+			if err == io.EOF {
+				return token{}, r.parseError("unterminated comment")
+			} else if err != nil {
+				return token{}, err
+			}
+			return token{kind: tokenComment, value: strings.Join(strings.Fields(comment), " ")}, nil
+		case c == '(':
+			return token{kind: tokenVariationStart}, nil
+		case c == ')':
+			return token{kind: tokenVariationEnd}, nil
+		case c == '*':
+			return token{kind: tokenResult, value: Unknown}, nil
+		case c == '$':
+			return token{kind: tokenNAG, value: r.readSymbol()}, nil
+		case isSymbolByte(c):
+			r.unreadByte()
+			symbol := r.readSymbol()
+			if symbol == WhiteWins || symbol == BlackWins || symbol == Draw {
+				return token{kind: tokenResult, value: symbol}, nil
+			}
+			return token{kind: tokenSymbol, value: symbol}, nil
+		}
+		// Unknown characters are ignored
+	}
+}
+
+func (r *Reader) readUntil(delim byte) (string, error) {
+	var sb strings.Builder
+	for {
+		c, err := r.readByte()
+		if err != nil {
+			return sb.String(), err
+		}
+		if c == delim {
+			return sb.String(), nil
+		}
+		sb.WriteByte(c)
+	}
+}
+
+func (r *Reader) readSymbol() string {
+	var sb strings.Builder
+	for {
+		c, err := r.readByte()
+		if err != nil {
+			return sb.String()
+		}
+		if !isSymbolByte(c) {
+			r.unreadByte()
+			if c == '\n' {
+				r.line--
+			}
+			return sb.String()
+		}
+		sb.WriteByte(c)
+	}
+}
+
+func (r *Reader) readTag() (token, error) {
+	content, err := r.readTagContent()
+	if err != nil {
+		return token{}, err
+	}
+	content = strings.TrimSpace(content)
+	nameEnd := strings.IndexAny(content, " \t")
+	if nameEnd == -1 {
+		return token{}, r.parseError("invalid tag [%s]", content)
+	}
+	value := strings.TrimSpace(content[nameEnd:])
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return token{}, r.parseError("invalid tag value %s", value)
+	}
+	value = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(value[1 : len(value)-1])
+	return token{kind: tokenTag, name: content[:nameEnd], value: value}, nil
+}
+
+// Closing bracket inside quoted value does not end the tag
+func (r *Reader) readTagContent() (string, error) {
+	var sb strings.Builder
+	quoted, escaped := false, false
+	for {
+		c, err := r.readByte()
+		if err == io.EOF {
+			return "", r.parseError("unterminated tag")
+		} else if err != nil {
+			return "", err
+		}
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && quoted:
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ']' && !quoted:
+			return sb.String(), nil
+		}
+		sb.WriteByte(c)
+	}
+}
@@ -0,0 +1,141 @@
+package pgn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mhib/combusken/backend"
+	"github.com/mhib/combusken/utils"
+)
+
+const maxLineLength = 79
+
+// Writer writes games in export format
+type Writer struct {
+	w *bufio.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Write writes game followed by empty line and flushes underlying writer
+func (w *Writer) Write(game *Game) error {
+	for _, tag := range game.exportTags() {
+		fmt.Fprintf(w.w, "[%s \"%s\"]\n", tag.Name, strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(tag.Value))
+	}
+	w.w.WriteByte('\n')
+
+	var tokens []string
+	if game.Comment != "" {
+		tokens = appendComment(tokens, game.Comment)
+	}
+	tokens = appendLine(tokens, game.Start, game.Moves)
+	tokens = append(tokens, game.Result)
+
+	lineLength := 0
+	for _, tok := range tokens {
+		if lineLength > 0 && lineLength+1+len(tok) > maxLineLength {
+			w.w.WriteByte('\n')
+			lineLength = 0
+		}
+		if lineLength > 0 {
+			w.w.WriteByte(' ')
+			lineLength++
+		}
+		w.w.WriteString(tok)
+		lineLength += len(tok)
+	}
+	w.w.WriteString("\n\n")
+	return w.w.Flush()
+}
+
+// Seven Tag Roster goes first, missing values are replaced with "?"
+func (g *Game) exportTags() []Tag {
+	res := make([]Tag, 0, len(g.Tags)+len(sevenTagRoster)+2)
+	for _, name := range sevenTagRoster {
+		value := g.Tag(name)
+		switch {
+		case name == "Result":
+			value = g.Result
+		case value == "" && name == "Date":
+			value = "????.??.??"
+		case value == "":
+			value = "?"
+		}
+		res = append(res, Tag{name, value})
+	}
+	if fen := g.Start.Fen(); fen != backend.InitialPositionFen && g.Tag("FEN") == "" {
+		res = append(res, Tag{"SetUp", "1"}, Tag{"FEN", fen})
+	}
+	for _, tag := range g.Tags {
+		if !isSevenTagRoster(tag.Name) {
+			res = append(res, tag)
+		}
+	}
+	return res
+}
+
+func isSevenTagRoster(name string) bool {
+	for _, rosterName := range sevenTagRoster {
+		if rosterName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// appendLine appends movetext tokens of line played from pos
+func appendLine(tokens []string, pos backend.Position, nodes []Node) []string {
+	// Black's move needs number at the start of line and after comments or variations
+	needsNumber := true
+	for _, node := range nodes {
+		if node.CommentBefore != "" {
+			tokens = appendComment(tokens, node.CommentBefore)
+			needsNumber = true
+		}
+		fullMove := strconv.Itoa(utils.Max(1, pos.FullMove))
+		if pos.SideToMove == backend.White {
+			tokens = append(tokens, fullMove+".")
+		} else if needsNumber {
+			tokens = append(tokens, fullMove+"...")
+		}
+		tokens = append(tokens, pos.ToSAN(node.Move))
+		for _, nag := range node.NAGs {
+			tokens = append(tokens, "$"+strconv.Itoa(nag))
+		}
+		needsNumber = false
+		if node.Comment != "" {
+			tokens = appendComment(tokens, node.Comment)
+			needsNumber = true
+		}
+		for _, variation := range node.Variations {
+			if len(variation) == 0 {
+				continue
+			}
+			start := len(tokens)
+			tokens = appendLine(tokens, pos, variation)
+			tokens[start] = "(" + tokens[start]
+			tokens[len(tokens)-1] += ")"
+			needsNumber = true
+		}
+		var child backend.Position
+		pos.MakeLegalMove(node.Move, &child)
+		pos = child
+	}
+	return tokens
+}
+
+// Comment is split into words, so it can be wrapped
+func appendComment(tokens []string, comment string) []string {
+	words := strings.Fields(strings.Replace(comment, "}", "", -1))
+	if len(words) == 0 {
+		return tokens
+	}
+	words[0] = "{" + words[0]
+	words[len(words)-1] += "}"
+	return append(tokens, words...)
+}
@@ -0,0 +1,35 @@
+#!/usr/bin/env bash
+# Compares `combusken bench` of two revisions.
+# Runs of both builds are interleaved, so changes of machine load affect them equally.
+# Usage: tools/compare_bench.bash base-revision [new-revision] [runs]
+set -euo pipefail
+
+base=$1
+new=${2:-HEAD}
+runs=${3:-5}
+root=$(git rev-parse --show-toplevel)
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"; git -C "$root" worktree prune' EXIT
+
+for rev in "$base" "$new"; do
+        dir="$tmp/src-$rev"
+        git -C "$root" worktree add --detach --quiet "$dir" "$rev"
+        (cd "$dir" && go build -o "$tmp/combusken-$rev" combusken.go)
+done
+
+# Bench loads positions relative to working directory
+cd "$root"
+for ((i = 0; i < runs; i++)); do
+        for rev in "$base" "$new"; do
+                "$tmp/combusken-$rev" bench | awk '$1 == "Time" { time = $3 } $1 == "Nodes" { nodes = $3 } END { print nodes, time }' >> "$tmp/results-$rev"
+        done
+done
+
+for rev in "$base" "$new"; do
+        sort -n -k 2 "$tmp/results-$rev" | awk -v rev="$rev" '
+                { nodes = $1; t[NR] = $2 }
+                END {
+                        median = NR % 2 ? t[(NR + 1) / 2] : (t[NR / 2] + t[NR / 2 + 1]) / 2
+                        printf "%s: nodes %d, time %d-%d ms, median %d ms, %d NPS\n", rev, nodes, t[1], t[NR], median, nodes * 1000 / median
+                }'
+done
@@ -6,6 +6,6 @@ import "unsafe"
 import . "github.com/mhib/combusken/utils"
 
 func NewTransTable(megabytes int) TranspositionTable {
-	size := NearestPowerOfTwo(1024 * 1024 * megabytes / int(unsafe.Sizeof(transEntry{})))
-	return TranspositionTable{make([]transEntry, size), size - 1}
+	size := NearestPowerOfTwo(1024 * 1024 * megabytes / int(unsafe.Sizeof(transBucket{})))
+	return TranspositionTable{Buckets: make([]transBucket, size), Mask: size - 1}
 }
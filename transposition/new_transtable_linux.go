@@ -8,9 +8,9 @@ import "golang.org/x/sys/unix"
 import "reflect"
 
 func NewTransTable(megabytes int) TranspositionTable {
-	sizeOfEntry := uint64(unsafe.Sizeof(transEntry{}))
-	entriesCount := NearestPowerOfTwo(1024 * 1024 * megabytes / int(sizeOfEntry))
-	table := TranspositionTable{make([]transEntry, entriesCount), entriesCount - 1}
-	unix.Syscall(unix.SYS_MADVISE, uintptr((*reflect.SliceHeader)(unsafe.Pointer(&table)).Data), uintptr(entriesCount*sizeOfEntry), uintptr(unix.MADV_HUGEPAGE))
+	sizeOfBucket := uint64(unsafe.Sizeof(transBucket{}))
+	bucketsCount := NearestPowerOfTwo(1024 * 1024 * megabytes / int(sizeOfBucket))
+	table := TranspositionTable{Buckets: make([]transBucket, bucketsCount), Mask: bucketsCount - 1}
+	unix.Syscall(unix.SYS_MADVISE, uintptr((*reflect.SliceHeader)(unsafe.Pointer(&table)).Data), uintptr(bucketsCount*sizeOfBucket), uintptr(unix.MADV_HUGEPAGE))
 	return table
 }
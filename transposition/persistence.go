@@ -0,0 +1,132 @@
+package transposition
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unsafe"
+
+	"github.com/mhib/combusken/backend"
+)
+
+const fileMagic = "CBTT"
+const fileVersion = 2
+
+// Header is written before entries.
+// Table saved with different entry layout or hashing scheme cannot be loaded.
+type fileHeader struct {
+	Magic       [4]byte
+	Version     uint32
+	EntrySize   uint32
+	BucketSize  uint32
+	ZobristSeed int64
+	// Key of initial position changes with any change of hashing
+	InitialKey uint64
+	Entries    uint64
+	Generation uint32
+}
+
+func currentHeader(entries int) fileHeader {
+	header := fileHeader{
+		Version:     fileVersion,
+		EntrySize:   uint32(unsafe.Sizeof(transEntry{})),
+		BucketSize:  BucketSize,
+		ZobristSeed: backend.ZobristSeed,
+		InitialKey:  backend.InitialPosition.Key,
+		Entries:     uint64(entries),
+	}
+	copy(header.Magic[:], fileMagic)
+	return header
+}
+
+// Save writes header and all entries of table
+func (t *TranspositionTable) Save(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	header := currentHeader(len(t.Buckets) * BucketSize)
+	header.Generation = uint32(t.generation)
+	if err := binary.Write(bw, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	var buf [16]byte
+	for i := range t.Buckets {
+		for j := range t.Buckets[i] {
+			if err := writeEntry(bw, &t.Buckets[i][j], buf[:]); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+func writeEntry(w io.Writer, slot *transEntry, buf []byte) error {
+	entry := slot.load()
+	binary.LittleEndian.PutUint32(buf[0:], entry.key)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(entry.bestMove))
+	binary.LittleEndian.PutUint16(buf[8:], uint16(entry.value))
+	binary.LittleEndian.PutUint16(buf[10:], uint16(entry.eval))
+	buf[12] = entry.flag
+	buf[13] = entry.depth
+	buf[14] = entry.generation
+	_, err := w.Write(buf)
+	return err
+}
+
+// LoadTransTable reads table written by Save from stream of given size.
+// Loaded table has the size of the saved one, which cannot be larger than maxMegabytes.
+func LoadTransTable(r io.Reader, size int64, maxMegabytes int) (TranspositionTable, error) {
+	br := bufio.NewReader(r)
+	var header fileHeader
+	if err := binary.Read(br, binary.LittleEndian, &header); err != nil {
+		return TranspositionTable{}, err
+	}
+	expected := currentHeader(int(header.Entries))
+	switch {
+	case header.Magic != expected.Magic:
+		return TranspositionTable{}, errors.New("not a transposition table file")
+	case header.Version != expected.Version:
+		return TranspositionTable{}, fmt.Errorf("unsupported transposition table file version %d", header.Version)
+	case header.EntrySize != expected.EntrySize || header.BucketSize != expected.BucketSize:
+		return TranspositionTable{}, fmt.Errorf("entry size %d and bucket size %d do not match %d and %d",
+			header.EntrySize, header.BucketSize, expected.EntrySize, expected.BucketSize)
+	case header.ZobristSeed != expected.ZobristSeed || header.InitialKey != expected.InitialKey:
+		return TranspositionTable{}, errors.New("hash keys do not match")
+	}
+	buckets := header.Entries / BucketSize
+	if header.Entries%BucketSize != 0 || buckets == 0 || buckets&(buckets-1) != 0 {
+		return TranspositionTable{}, fmt.Errorf("invalid number of entries %d", header.Entries)
+	}
+	// Size is checked before allocation, so corrupted header cannot request arbitrary memory
+	if buckets > uint64(maxMegabytes)*1024*1024/uint64(unsafe.Sizeof(transBucket{})) {
+		return TranspositionTable{}, fmt.Errorf("table with %d entries is larger than %d MB", header.Entries, maxMegabytes)
+	}
+	if expectedSize := int64(binary.Size(header)) + int64(header.Entries)*int64(header.EntrySize); size != expectedSize {
+		return TranspositionTable{}, fmt.Errorf("file size %d does not match %d entries", size, header.Entries)
+	}
+
+	table := TranspositionTable{Buckets: make([]transBucket, buckets), Mask: buckets - 1, generation: uint8(header.Generation)}
+	var buf [16]byte
+	for i := range table.Buckets {
+		for j := range table.Buckets[i] {
+			if _, err := io.ReadFull(br, buf[:header.EntrySize]); err != nil {
+				return TranspositionTable{}, err
+			}
+			table.Buckets[i][j].store(entryFields{
+				key:        binary.LittleEndian.Uint32(buf[0:]),
+				bestMove:   backend.Move(binary.LittleEndian.Uint32(buf[4:])),
+				value:      int16(binary.LittleEndian.Uint16(buf[8:])),
+				eval:       int16(binary.LittleEndian.Uint16(buf[10:])),
+				flag:       buf[12],
+				depth:      buf[13],
+				generation: buf[14],
+			})
+		}
+	}
+	return table, nil
+}
+
+// Megabytes returns size of table in megabytes
+func (t *TranspositionTable) Megabytes() int {
+	return len(t.Buckets) * int(unsafe.Sizeof(transBucket{})) / (1024 * 1024)
+}
@@ -0,0 +1,59 @@
+package transposition
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/mhib/combusken/backend"
+)
+
+func TestSaveLoad(t *testing.T) {
+	table := NewTransTable(1)
+	table.NewSearch()
+	pos := backend.InitialPosition
+	move := backend.NewMove(backend.E2, backend.E4, backend.Pawn, backend.None, backend.DoublePawnPush)
+	table.Set(pos.Key, 35, -12, 9, move, 2)
+
+	var buf bytes.Buffer
+	if err := table.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	loaded, err := LoadTransTable(bytes.NewReader(data), int64(len(data)), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Buckets) != len(table.Buckets) || loaded.generation != table.generation {
+		t.Fatalf("expected %d buckets, got %d", len(table.Buckets), len(loaded.Buckets))
+	}
+	ok, value, eval, depth, bestMove, flag := loaded.Get(pos.Key)
+	if !ok || value != 35 || eval != -12 || depth != 9 || bestMove != move || flag != 2 {
+		t.Errorf("unexpected entry %v %v %v %v %v %v", ok, value, eval, depth, bestMove, flag)
+	}
+
+	corrupted := append([]byte{}, data...)
+	corrupted[8]++
+	if _, err := LoadTransTable(bytes.NewReader(corrupted), int64(len(corrupted)), 1); err == nil {
+		t.Error("expected entry size error")
+	}
+	if _, err := LoadTransTable(bytes.NewReader(data[:len(data)-1]), int64(len(data)), 1); err == nil {
+		t.Error("expected error for truncated file")
+	}
+	if _, err := LoadTransTable(bytes.NewReader(data[:len(data)-1]), int64(len(data)-1), 1); err == nil {
+		t.Error("expected error for file size not matching entries")
+	}
+	if loaded.Megabytes() != 1 {
+		t.Errorf("expected 1 MB table, got %d", loaded.Megabytes())
+	}
+
+	// Huge number of entries in header must be rejected before allocation
+	huge := append([]byte{}, data...)
+	binary.LittleEndian.PutUint64(huge[32:], 1<<40)
+	if _, err := LoadTransTable(bytes.NewReader(huge), int64(len(huge)), 1024*256); err == nil {
+		t.Error("expected error for too large table")
+	}
+	if _, err := LoadTransTable(bytes.NewReader(data), int64(len(data)), 0); err == nil {
+		t.Error("expected error for table larger than limit")
+	}
+}
@@ -1,11 +1,13 @@
 package transposition
 
+import "sync/atomic"
 import "github.com/mhib/combusken/backend"
 import . "github.com/mhib/combusken/utils"
 
 const NoneDepth = -6
 
-var GlobalTransTable TranspositionTable
+// Number of entries sharing one cache line
+const BucketSize = 4
 
 func ValueFromTrans(value int16, height int) int16 {
 	if value >= Mate-500 {
@@ -30,50 +32,153 @@ func ValueToTrans(value int, height int) int16 {
 
 }
 
+// transEntry is shared by search threads without locks, so it is stored in two words accessed atomically.
+// Upper half of key word is upper half of position key xored with the rest of entry,
+// so entry torn by concurrent writes does not match any position.
 type transEntry struct {
-	key      uint32
-	bestMove backend.Move
-	value    int16
-	eval     int16
-	flag     uint8
-	depth    uint8
+	key  uint64
+	data uint64
 }
 
+// Unpacked content of transEntry
+type entryFields struct {
+	key        uint32
+	bestMove   backend.Move
+	value      int16
+	eval       int16
+	flag       uint8
+	depth      uint8
+	generation uint8
+}
+
+func (e *transEntry) load() (fields entryFields) {
+	key := atomic.LoadUint64(&e.key)
+	data := atomic.LoadUint64(&e.data)
+	meta := uint32(key)
+	fields.key = uint32(key>>32) ^ entryCheck(data, meta)
+	fields.bestMove = backend.Move(uint32(data))
+	fields.value = int16(data >> 32)
+	fields.eval = int16(data >> 48)
+	fields.flag = uint8(meta)
+	fields.depth = uint8(meta >> 8)
+	fields.generation = uint8(meta >> 16)
+	return
+}
+
+func (e *transEntry) store(fields entryFields) {
+	data := uint64(uint32(fields.bestMove)) | uint64(uint16(fields.value))<<32 | uint64(uint16(fields.eval))<<48
+	meta := uint32(fields.flag) | uint32(fields.depth)<<8 | uint32(fields.generation)<<16
+	atomic.StoreUint64(&e.key, uint64(fields.key^entryCheck(data, meta))<<32|uint64(meta))
+	atomic.StoreUint64(&e.data, data)
+}
+
+func entryCheck(data uint64, meta uint32) uint32 {
+	return uint32(data) ^ uint32(data>>32) ^ meta
+}
+
+type transBucket [BucketSize]transEntry
+
 type TranspositionTable struct {
-	Entries []transEntry
+	Buckets []transBucket
 	Mask    uint64
+	// Incremented for every search, so entries from older searches are replaced first
+	generation uint8
 }
 
 func (t *TranspositionTable) Clear() {
-	for i := range t.Entries {
-		t.Entries[i] = transEntry{}
+	for i := range t.Buckets {
+		t.Buckets[i] = transBucket{}
 	}
+	t.generation = 0
+}
+
+// NewSearch should be called before every search
+func (t *TranspositionTable) NewSearch() {
+	t.generation++
+}
+
+// Hashfull returns permill of entries written in current search.
+// It is estimated from the first thousand entries.
+func (t *TranspositionTable) Hashfull() int {
+	buckets := Min(len(t.Buckets), 1000/BucketSize)
+	if buckets == 0 {
+		return 0
+	}
+	used := 0
+	for i := 0; i < buckets; i++ {
+		for j := range t.Buckets[i] {
+			// Generation is read from key word without unpacking the rest of entry
+			key := atomic.LoadUint64(&t.Buckets[i][j].key)
+			if key != 0 && uint8(key>>16) == t.generation {
+				used++
+			}
+		}
+	}
+	return used * 1000 / (buckets * BucketSize)
 }
 
 func (t *TranspositionTable) Get(key uint64) (ok bool, value int16, eval int16, depth int16, move backend.Move, flag uint8) {
-	var element = &t.Entries[key&t.Mask]
-	if element.key != uint32(key>>32) {
+	var bucket = &t.Buckets[key&t.Mask]
+	var upperKey = uint32(key >> 32)
+	for i := range bucket {
+		var element = bucket[i].load()
+		if element.key != upperKey {
+			continue
+		}
+		ok = true
+		value = element.value
+		eval = element.eval
+		depth = int16(element.depth) + NoneDepth
+		move = element.bestMove
+		flag = element.flag
 		return
 	}
-	ok = true
-	value = element.value
-	eval = element.eval
-	depth = int16(element.depth) + NoneDepth
-	move = element.bestMove
-	flag = element.flag
 	return
 }
 
+// Set stores entry in slot with the same key,
+// otherwise replaces entry with the lowest depth adjusted by age.
+// Generation of entry is refreshed only here, so probes do not write to the table.
 func (t *TranspositionTable) Set(key uint64, value int16, eval int16, depth int, bestMove backend.Move, flag int) {
-	var element = &t.Entries[key&t.Mask]
-	element.key = uint32(key >> 32)
-	element.value = value
-	element.eval = eval
-	element.flag = uint8(flag)
-	element.depth = uint8(depth - NoneDepth)
-	element.bestMove = bestMove
+	var bucket = &t.Buckets[key&t.Mask]
+	var upperKey = uint32(key >> 32)
+	var slot = &bucket[0]
+	var element = slot.load()
+	for i := range bucket {
+		var candidate = bucket[i].load()
+		if candidate.key == upperKey {
+			slot, element = &bucket[i], candidate
+			break
+		}
+		if t.replaceScore(&candidate) < t.replaceScore(&element) {
+			slot, element = &bucket[i], candidate
+		}
+	}
+	if element.key == upperKey {
+		// Keep deeper result of the same search, unless new one is exact
+		if flag != TransExact && element.generation == t.generation && depth-NoneDepth+3 < int(element.depth) {
+			return
+		}
+		if bestMove == backend.NullMove {
+			bestMove = element.bestMove
+		}
+	}
+	slot.store(entryFields{
+		key:        upperKey,
+		bestMove:   bestMove,
+		value:      value,
+		eval:       eval,
+		flag:       uint8(flag),
+		depth:      uint8(depth - NoneDepth),
+		generation: t.generation,
+	})
+}
+
+func (t *TranspositionTable) replaceScore(element *entryFields) int {
+	age := int(t.generation - element.generation)
+	return int(element.depth) - 8*age
 }
 
 func (t *TranspositionTable) Prefetch(key uint64) {
-	prefetch(&t.Entries[key&t.Mask])
+	prefetch(&t.Buckets[key&t.Mask][0])
 }
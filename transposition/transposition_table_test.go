@@ -0,0 +1,87 @@
+package transposition
+
+import (
+	"testing"
+
+	. "github.com/mhib/combusken/utils"
+)
+
+// Keys with the same lower bits map to the same bucket
+func collidingKey(i int) uint64 {
+	return uint64(i+1)<<32 | 7
+}
+
+func TestReplacement(t *testing.T) {
+	table := NewTransTable(1)
+	table.NewSearch()
+	table.Set(collidingKey(0), 10, 0, 20, 0, TransExact)
+	// Shallow entries fill the bucket, but do not evict the deep one
+	for i := 1; i <= 2*BucketSize; i++ {
+		table.Set(collidingKey(i), 0, 0, NoneDepth, 0, TransNone)
+	}
+	if ok, _, _, depth, _, _ := table.Get(collidingKey(0)); !ok || depth != 20 {
+		t.Errorf("deep entry was replaced")
+	}
+
+	// Shallower result of the same position does not replace deeper one
+	table.Set(collidingKey(0), 5, 0, 3, 0, TransAlpha)
+	if _, value, _, depth, _, _ := table.Get(collidingKey(0)); value != 10 || depth != 20 {
+		t.Errorf("expected deeper entry to be kept, got value %d depth %d", value, depth)
+	}
+
+	// Entries from old searches are replaced first
+	for i := 0; i < 16; i++ {
+		table.NewSearch()
+	}
+	for i := 1; i < BucketSize; i++ {
+		table.Set(collidingKey(100+i), 0, 0, 1, 0, TransAlpha)
+	}
+	table.Set(collidingKey(200), 0, 0, 1, 0, TransAlpha)
+	if ok, _, _, _, _, _ := table.Get(collidingKey(0)); ok {
+		t.Errorf("old entry was not replaced")
+	}
+	for i := 1; i < BucketSize; i++ {
+		if ok, _, _, _, _, _ := table.Get(collidingKey(100 + i)); !ok {
+			t.Errorf("entry of current search was replaced")
+		}
+	}
+}
+
+func TestHashfull(t *testing.T) {
+	table := NewTransTable(1)
+	table.NewSearch()
+	if hashfull := table.Hashfull(); hashfull != 0 {
+		t.Fatalf("expected empty table, got %d", hashfull)
+	}
+	for i := 0; i < 1000; i++ {
+		table.Set(uint64(i+1)<<32|uint64(i), 0, 0, 1, 0, TransExact)
+	}
+	if hashfull := table.Hashfull(); hashfull == 0 {
+		t.Errorf("expected used entries")
+	}
+	table.NewSearch()
+	if hashfull := table.Hashfull(); hashfull != 0 {
+		t.Errorf("entries of previous search should not be counted, got %d", hashfull)
+	}
+	// Probes do not mark entries as written in current search
+	for i := 0; i < 1000; i++ {
+		if ok, _, _, _, _, _ := table.Get(uint64(i+1)<<32 | uint64(i)); !ok {
+			t.Fatalf("entry %d not found", i)
+		}
+	}
+	if hashfull := table.Hashfull(); hashfull != 0 {
+		t.Errorf("probed entries should not be counted, got %d", hashfull)
+	}
+}
+
+func TestTornEntry(t *testing.T) {
+	table := NewTransTable(1)
+	table.Set(collidingKey(0), 10, 0, 5, 0, TransExact)
+	table.Set(collidingKey(1), 20, 0, 5, 0, TransExact)
+	// Mix words of two entries, as concurrent writes to one slot could
+	bucket := &table.Buckets[collidingKey(0)&table.Mask]
+	bucket[0].data = bucket[1].data
+	if ok, _, _, _, _, _ := table.Get(collidingKey(0)); ok {
+		t.Errorf("torn entry matched key")
+	}
+}
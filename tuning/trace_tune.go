@@ -235,7 +235,7 @@ func (tuner *traceTuner) parseTraceEntry(t *thread, fen string) (traceEntry, boo
 		board = child
 	}
 	T = Trace{}
-	res.eval = float64(Evaluate(&board))
+	res.eval = float64(Evaluate(&board, nil))
 
 	// Do not care about scaled positions
 	if ScaleFactor(&board, int16(res.eval)) != SCALE_NORMAL {
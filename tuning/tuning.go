@@ -3,6 +3,7 @@ package tuning
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
 	"os"
@@ -16,6 +17,7 @@ import (
 	. "github.com/mhib/combusken/backend"
 	"github.com/mhib/combusken/engine"
 	. "github.com/mhib/combusken/evaluation"
+	"github.com/mhib/combusken/pgn"
 	. "github.com/mhib/combusken/utils"
 )
 
@@ -68,7 +70,7 @@ func (t *thread) quiescence(alpha, beta, height int, inCheck bool) int {
 
 	moveCount := 0
 
-	val := Evaluate(pos)
+	val := Evaluate(pos, nil)
 
 	var evaled []EvaledMove
 	if inCheck {
@@ -122,28 +124,7 @@ type tuner struct {
 }
 
 func Tune() {
-	inputChan := make(chan string)
-	go loadEntries(inputChan)
-	wg := &sync.WaitGroup{}
-	resultChan := make(chan tuneEntry)
-	for i := 0; i < runtime.NumCPU(); i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			var t thread
-			for fen := range inputChan {
-				parseEntry(&t, fen, resultChan)
-			}
-		}()
-	}
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
-	t := &tuner{done: false}
-	for entry := range resultChan {
-		t.entries = append(t.entries, entry)
-	}
+	t := &tuner{done: false, entries: parseEntries()}
 	fmt.Println("Number of entries:")
 	fmt.Println(len(t.entries))
 	t.calculateOptimalK()
@@ -180,6 +161,32 @@ func Tune() {
 
 }
 
+// parseEntries loads games and extracts quiet positions from them
+func parseEntries() (entries []tuneEntry) {
+	inputChan := make(chan string)
+	go loadEntries(inputChan)
+	wg := &sync.WaitGroup{}
+	resultChan := make(chan tuneEntry)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var t thread
+			for fen := range inputChan {
+				parseEntry(&t, fen, resultChan)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
+	for entry := range resultChan {
+		entries = append(entries, entry)
+	}
+	return
+}
+
 func (t *tuner) computeError(entriesCount int) float64 {
 	numCPU := runtime.NumCPU()
 	results := make([]float64, numCPU)
@@ -191,7 +198,7 @@ func (t *tuner) computeError(entriesCount int) float64 {
 			var c, sum float64
 			for y := idx; y < entriesCount; y += numCPU {
 				entry := t.entries[y]
-				evaluation := float64(Evaluate(&entry.Position))
+				evaluation := float64(Evaluate(&entry.Position, nil))
 				if entry.Position.SideToMove == Black {
 					evaluation *= -1
 				}
@@ -243,16 +250,8 @@ func (t *tuner) calculateOptimalK() {
 
 func parseEntry(t *thread, fen string, resultChan chan tuneEntry) {
 	var res tuneEntry
-	sepIdx := strings.Index(fen, ";")
-	boardFen := fen[:sepIdx]
-	score := fen[sepIdx+1:]
-	if strings.Contains(score, "1-0") {
-		res.result = 1.0
-	} else if strings.Contains(score, "0-1") {
-		res.result = 0.0
-	} else {
-		res.result = 0.5
-	}
+	boardFen, result := splitEntry(fen)
+	res.result = result
 	board := ParseFen(boardFen)
 	t.stack[0].position = board
 	t.quiescence(-Mate, Mate, 0, board.IsInCheck())
@@ -266,10 +265,29 @@ func parseEntry(t *thread, fen string, resultChan chan tuneEntry) {
 	resultChan <- res
 }
 
+// splitEntry separates FEN of loaded entry from result of its game
+func splitEntry(entry string) (boardFen string, result float64) {
+	sepIdx := strings.Index(entry, ";")
+	boardFen = entry[:sepIdx]
+	score := entry[sepIdx+1:]
+	if strings.Contains(score, "1-0") {
+		result = 1.0
+	} else if strings.Contains(score, "0-1") {
+		result = 0.0
+	} else {
+		result = 0.5
+	}
+	return
+}
+
 func loadEntries(inputChan chan string) {
 	defer close(inputChan)
 	absPath, _ := filepath.Abs("./games.fen")
 	file, err := os.Open(absPath)
+	if os.IsNotExist(err) {
+		loadPgnEntries(inputChan)
+		return
+	}
 	if err != nil {
 		panic(err)
 	}
@@ -280,6 +298,41 @@ func loadEntries(inputChan chan string) {
 	}
 }
 
+// loadPgnEntries extracts positions from games.pgn the same way as tools/pgn_to_fen.rb.
+// Positions are taken only from moves commented by engine, omitting book moves and mate scores.
+func loadPgnEntries(inputChan chan string) {
+	absPath, _ := filepath.Abs("./games.pgn")
+	file, err := os.Open(absPath)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	reader := pgn.NewReader(file)
+	for {
+		game, err := reader.Next()
+		if err == io.EOF {
+			return
+		}
+		// Malformed games are skipped, but reading cannot be continued after error of file
+		if _, ok := err.(*pgn.ParseError); ok {
+			fmt.Println(err)
+			continue
+		} else if err != nil {
+			panic(err)
+		}
+		positions := game.Positions()
+		for idx, node := range game.Moves {
+			if node.Comment == "" || strings.Contains(node.Comment, "M") {
+				break
+			}
+			if idx == 0 || strings.Contains(node.Comment, "book") {
+				continue
+			}
+			inputChan <- positions[idx].Fen() + ";" + game.Result
+		}
+	}
+}
+
 func sigmoid(K, S float64) float64 {
 	return 1.0 / (1.0 + math.Pow(10.0, -K*S/400.0))
 }
@@ -0,0 +1,125 @@
+package tuning
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+
+	. "github.com/mhib/combusken/backend"
+	"github.com/mhib/combusken/engine"
+)
+
+// Depth of searches that score positions.
+// Model is applied to scores of search in UCI info, so it is fit to them instead of static evaluation.
+const wdlSearchDepth = 6
+
+type wdlSample struct {
+	score  float64
+	result float64
+}
+
+// FitWDL finds parameters of win/draw/loss model used by UCI_ShowWDL.
+// Games are loaded the same way as in Tune, but positions are scored by search.
+func FitWDL() {
+	samples := searchWDLSamples()
+	fmt.Printf("Number of entries: %d\n", len(samples))
+	fmt.Printf("Current: scale %.4g, draw margin %.4g, log loss %.17g\n",
+		float64(engine.WDLScale), float64(engine.WDLDrawMargin), wdlLogLoss(samples, engine.WDLScale, engine.WDLDrawMargin))
+
+	scale, drawMargin := float64(engine.WDLScale), float64(engine.WDLDrawMargin)
+	scaleDelta, marginDelta := 0.5, 64.0
+	best := wdlLogLoss(samples, scale, drawMargin)
+	for i := 0; i < 12; i++ {
+		improved := true
+		for improved {
+			improved = false
+			for _, candidate := range [][2]float64{
+				{scale + scaleDelta, drawMargin}, {scale - scaleDelta, drawMargin},
+				{scale, drawMargin + marginDelta}, {scale, drawMargin - marginDelta},
+			} {
+				if candidate[0] <= 0 || candidate[1] < 0 {
+					continue
+				}
+				if loss := wdlLogLoss(samples, candidate[0], candidate[1]); loss < best {
+					best = loss
+					scale, drawMargin = candidate[0], candidate[1]
+					improved = true
+				}
+			}
+		}
+		scaleDelta /= 2
+		marginDelta /= 2
+		fmt.Printf("Step %d: scale %.4g, draw margin %.4g, log loss %.17g\n", i+1, scale, drawMargin, best)
+	}
+	fmt.Printf("const WDLScale = %.4g\nconst WDLDrawMargin = %d\n", scale, int(math.Round(drawMargin)))
+}
+
+// searchWDLSamples scores loaded positions with search of wdlSearchDepth.
+// Positions with mate scores are skipped, as the model does not apply to them.
+func searchWDLSamples() (samples []wdlSample) {
+	inputChan := make(chan string)
+	go loadEntries(inputChan)
+	wg := &sync.WaitGroup{}
+	resultChan := make(chan wdlSample)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e, err := engine.New(map[string]string{"Hash": "16"})
+			if err != nil {
+				panic(err)
+			}
+			defer e.Close()
+			var last engine.SearchInfo
+			e.Update = func(si engine.SearchInfo) {
+				last = si
+			}
+			for line := range inputChan {
+				boardFen, result := splitEntry(line)
+				pos := ParseFen(boardFen)
+				e.Search(context.Background(), engine.SearchParams{Positions: []Position{pos}, Limits: engine.LimitsType{Depth: wdlSearchDepth}})
+				if last.Score.Mate != 0 {
+					continue
+				}
+				score := float64(last.Score.Centipawn)
+				if pos.SideToMove == Black {
+					score *= -1
+				}
+				resultChan <- wdlSample{score, result}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
+	for sample := range resultChan {
+		samples = append(samples, sample)
+		if len(samples)%10000 == 0 {
+			fmt.Printf("Searched %d positions\n", len(samples))
+		}
+	}
+	return
+}
+
+// Mean negative log likelihood of game results
+func wdlLogLoss(samples []wdlSample, scale, drawMargin float64) float64 {
+	var sum float64
+	for _, sample := range samples {
+		win := engine.WinProbability(scale, drawMargin, sample.score)
+		loss := engine.WinProbability(scale, drawMargin, -sample.score)
+		var p float64
+		switch sample.result {
+		case 1.0:
+			p = win
+		case 0.0:
+			p = loss
+		default:
+			p = 1 - win - loss
+		}
+		sum -= math.Log(math.Max(p, 1e-9))
+	}
+	return sum / float64(len(samples))
+}
@@ -0,0 +1,89 @@
+package uci
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mhib/combusken/backend"
+)
+
+const perftUsage = "usage: combusken perft [-threads n] [-hash mb] [-nobulk] <depth> [fen]"
+
+// Size of perft hash table in megabytes, perft does not need search transposition table
+const perftHashSize = 16
+
+// Sent to state goroutine when go perft finishes
+type perftDone struct{}
+
+// Perft runs perft divide from command line arguments following "perft"
+func Perft(args []string) {
+	flags := flag.NewFlagSet("perft", flag.ExitOnError)
+	threads := flags.Int("threads", 1, "number of threads")
+	hash := flags.Int("hash", perftHashSize, "size of perft hash table in megabytes, 0 disables it")
+	noBulk := flags.Bool("nobulk", false, "visit leaves instead of counting legal moves at depth 1")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, perftUsage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	depth, err := strconv.Atoi(flags.Arg(0))
+	if err != nil || depth < 1 {
+		fmt.Fprintln(os.Stderr, "invalid depth "+flags.Arg(0))
+		os.Exit(2)
+	}
+	pos := backend.InitialPosition
+	if flags.NArg() > 1 {
+		if pos, err = backend.ParseFenStrict(strings.Join(flags.Args()[1:], " ")); err != nil {
+			fmt.Fprintln(os.Stderr, "invalid FEN: "+err.Error())
+			os.Exit(2)
+		}
+	}
+	options := backend.PerftOptions{Threads: *threads, Hash: *hash, Bulk: !*noBulk}
+	printDivide(&pos, depth, options, backend.Move.String)
+}
+
+func printDivide(pos *backend.Position, depth int, options backend.PerftOptions, moveString func(backend.Move) string) {
+	start := time.Now()
+	results := backend.Divide(pos, depth, options)
+	elapsed := time.Since(start)
+	for _, result := range results {
+		fmt.Printf("%s: %d\n", moveString(result.Move), result.Nodes)
+	}
+	nodes := backend.PerftNodes(results)
+	fmt.Printf("\nNodes searched: %d\n", nodes)
+	fmt.Printf("Time: %d ms\n", elapsed.Milliseconds())
+	if elapsed > 0 {
+		fmt.Printf("Nps: %d\n\n", int64(float64(nodes)/elapsed.Seconds()))
+	} else {
+		fmt.Println()
+	}
+}
+
+// go perft depth uses Threads option and its own small hash table.
+// It runs in background like search, so isready is answered, but it cannot be stopped.
+func (uci *UciProtocol) perftCommand(args ...string) {
+	if len(args) == 0 {
+		debugUci("Missing perft depth")
+		return
+	}
+	depth, err := strconv.Atoi(args[0])
+	if err != nil || depth < 1 {
+		debugUci("Invalid perft depth " + args[0])
+		return
+	}
+	options := backend.PerftOptions{Threads: uci.engine.Threads.Val, Hash: perftHashSize, Bulk: true}
+	pos := uci.positions[len(uci.positions)-1]
+	uci.state = uci.thinking
+	go func() {
+		printDivide(&pos, depth, options, uci.moveString)
+		uci.messages <- perftDone{}
+	}()
+}
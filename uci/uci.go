@@ -8,6 +8,7 @@ import "context"
 
 import (
 	"bufio"
+	"errors"
 	"os"
 	"strconv"
 	"strings"
@@ -21,10 +22,11 @@ type UciProtocol struct {
 	cancel    context.CancelFunc
 	state     func(msg interface{})
 	waitChan  chan interface{}
+	pondering bool
+	lastPV    []backend.Move
 }
 
 func NewUciProtocol(e Engine) *UciProtocol {
-	e.Update = updateUci
 	uci := &UciProtocol{
 		messages:  make(chan interface{}),
 		waitChan:  make(chan interface{}),
@@ -40,7 +42,11 @@ func NewUciProtocol(e Engine) *UciProtocol {
 		"ponderhit":  uci.ponderhitCommand,
 		"stop":       uci.stopCommand,
 		"setoption":  uci.setOptionCommand,
+		"savehash":   uci.saveHashCommand,
+		"loadhash":   uci.loadHashCommand,
 	}
+	uci.engine.Update = uci.updateUci
+	uci.engine.UpdateCurrentMove = uci.updateCurrentMove
 	close(uci.waitChan)
 	return uci
 }
@@ -94,11 +100,22 @@ func (uci *UciProtocol) thinking(msg interface{}) {
 		commandName := fields[0]
 		if commandName == "stop" {
 			uci.stopCommand()
+		} else if commandName == "ponderhit" {
+			uci.ponderhitCommand()
+		} else if commandName == "isready" {
+			fmt.Println("readyok")
 		} else {
 			debugUci("Unexpected command " + commandName + ".")
 		}
 	case backend.Move:
-		fmt.Printf("bestmove %s\n", msg.String())
+		if ponderMove := uci.ponderMove(msg); ponderMove != backend.NullMove {
+			fmt.Printf("bestmove %s ponder %s\n", uci.moveString(msg), uci.moveString(ponderMove))
+		} else {
+			fmt.Printf("bestmove %s\n", uci.moveString(msg))
+		}
+		uci.pondering = false
+		uci.state = uci.idle
+	case perftDone:
 		uci.state = uci.idle
 	}
 }
@@ -126,6 +143,10 @@ func (uci *UciProtocol) isReadyCommand(...string) {
 func (uci *UciProtocol) positionCommand(args ...string) {
 	uci.waitChan = make(chan interface{})
 	defer close(uci.waitChan)
+	if len(args) == 0 {
+		debugUci("Wrong position command")
+		return
+	}
 	var fen string
 	token := args[0]
 	movesIndex := findIndexString(args, "moves")
@@ -141,17 +162,14 @@ func (uci *UciProtocol) positionCommand(args ...string) {
 		debugUci("Wrong position command")
 		return
 	}
-	p := backend.ParseFen(fen)
-	positions := []backend.Position{p}
-	if movesIndex >= 0 && movesIndex+1 < len(args) {
-		for _, smove := range args[movesIndex+1:] {
-			newPos, ok := positions[len(positions)-1].MakeMoveLAN(smove)
-			if !ok {
-				debugUci("Wrong move")
-				return
-			}
-			positions = append(positions, newPos)
-		}
+	var moves []string
+	if movesIndex >= 0 {
+		moves = args[movesIndex+1:]
+	}
+	positions, err := ParsePosition(fen, moves...)
+	if err != nil {
+		debugUci("Invalid position: " + err.Error())
+		return
 	}
 	uci.positions = positions
 }
@@ -166,13 +184,30 @@ func findIndexString(slice []string, value string) int {
 }
 
 func (uci *UciProtocol) goCommand(fields ...string) {
+	if len(fields) > 0 && fields[0] == "perft" {
+		uci.perftCommand(fields[1:]...)
+		return
+	}
 	limits := parseLimits(fields)
+	searchMoves, skipped, err := parseSearchMoves(fields, &uci.positions[len(uci.positions)-1])
+	for _, lan := range skipped {
+		debugUci("Skipping illegal searchmove " + lan)
+	}
+	if err != nil {
+		// Searching other moves than requested would be misleading, GUI still expects bestmove
+		debugUci("Refusing go command: " + err.Error())
+		fmt.Println("bestmove 0000")
+		return
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	searchParams := SearchParams{
-		Positions: uci.positions,
-		Limits:    limits,
+		Positions:   uci.positions,
+		Limits:      limits,
+		SearchMoves: searchMoves,
 	}
 	uci.cancel = cancel
+	uci.pondering = limits.Ponder
+	uci.lastPV = nil
 	uci.state = uci.thinking
 	go func() {
 		var searchResult = uci.engine.Search(ctx, searchParams)
@@ -214,19 +249,106 @@ func parseLimits(args []string) (result LimitsType) {
 			i++
 		case "infinite":
 			result.Infinite = true
+		case "searchmoves":
+			for i+1 < len(args) && !goKeywords[args[i+1]] {
+				i++
+			}
 		}
 	}
 	return
 }
 
+var goKeywords = map[string]bool{
+	"searchmoves": true, "ponder": true, "wtime": true, "btime": true, "winc": true, "binc": true,
+	"movestogo": true, "depth": true, "nodes": true, "mate": true, "movetime": true, "infinite": true,
+}
+
+// parseSearchMoves returns legal moves following searchmoves and skipped illegal ones.
+// Error is returned only when none of the moves is legal.
+func parseSearchMoves(args []string, pos *backend.Position) (result []backend.Move, skipped []string, err error) {
+	idx := findIndexString(args, "searchmoves")
+	if idx == -1 {
+		return
+	}
+	legalMoves := backend.GenerateAllLegalMoves(pos)
+	for _, lan := range args[idx+1:] {
+		if goKeywords[lan] {
+			break
+		}
+		found := false
+		for _, move := range legalMoves {
+			if strings.EqualFold(move.String(), lan) || strings.EqualFold(move.StringChess960(), lan) {
+				result = append(result, move.Move)
+				found = true
+				break
+			}
+		}
+		if !found {
+			skipped = append(skipped, lan)
+		}
+	}
+	if len(result) == 0 {
+		return nil, skipped, errors.New("searchmoves without legal moves")
+	}
+	return
+}
+
 func (uci *UciProtocol) uciNewGameCommand(...string) {
 	uci.waitChan = make(chan interface{})
 	defer close(uci.waitChan)
 	uci.engine.NewGame()
+	if err := uci.engine.BookError(); err != nil {
+		debugUci("Could not load book: " + err.Error())
+	}
+}
+
+func (uci *UciProtocol) saveHashCommand(args ...string) {
+	uci.waitChan = make(chan interface{})
+	defer close(uci.waitChan)
+	if len(args) == 0 {
+		debugUci("Missing file name")
+		return
+	}
+	if err := uci.engine.SaveHash(strings.Join(args, " ")); err != nil {
+		debugUci("Could not save hash: " + err.Error())
+	}
+}
+
+func (uci *UciProtocol) loadHashCommand(args ...string) {
+	uci.waitChan = make(chan interface{})
+	defer close(uci.waitChan)
+	if len(args) == 0 {
+		debugUci("Missing file name")
+		return
+	}
+	if err := uci.engine.LoadHash(strings.Join(args, " ")); err != nil {
+		debugUci("Could not load hash: " + err.Error())
+	}
 }
 
 func (uci *UciProtocol) ponderhitCommand(...string) {
-	debugUci("Not implemented")
+	if !uci.pondering {
+		debugUci("Not pondering")
+		return
+	}
+	uci.pondering = false
+	uci.engine.PonderHit()
+}
+
+// Move to ponder on is taken from principal variation of the last reported iteration
+func (uci *UciProtocol) ponderMove(bestMove backend.Move) backend.Move {
+	if len(uci.lastPV) >= 2 && uci.lastPV[0] == bestMove {
+		return uci.lastPV[1]
+	}
+	return backend.NullMove
+}
+
+// In UCI_Chess960 mode castling is sent as king capturing its rook
+func (uci *UciProtocol) moveString(move backend.Move) string {
+	if uci.engine.Chess960.Val {
+		return move.StringChess960()
+	}
+	return move.String()
 }
 
 func (uci *UciProtocol) stopCommand(...string) {
@@ -235,20 +357,43 @@ func (uci *UciProtocol) stopCommand(...string) {
 	}
 }
 
-func updateUci(s SearchInfo) {
+func (uci *UciProtocol) updateCurrentMove(s CurrentMoveInfo) {
+	fmt.Printf("info depth %d currmove %s currmovenumber %d\n", s.Depth, uci.moveString(s.Move), s.Number)
+}
+
+func (uci *UciProtocol) updateUci(s SearchInfo) {
+	// Lines from failed aspiration windows are not complete
+	if s.MultiPV == 1 && !s.Score.LowerBound && !s.Score.UpperBound {
+		uci.lastPV = s.Moves
+	}
+	// Book move is not searched, so it has neither score nor statistics
+	if s.Book {
+		fmt.Printf("info depth 0 pv %s\n", uci.moveString(s.Moves[0]))
+		return
+	}
 	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("info depth %d nodes %d score ", s.Depth, s.Nodes))
+	sb.WriteString(fmt.Sprintf("info depth %d seldepth %d multipv %d nodes %d score ", s.Depth, s.SelDepth, s.MultiPV, s.Nodes))
 	if s.Score.Mate != 0 {
 		sb.WriteString(fmt.Sprintf("mate %d ", s.Score.Mate))
 	} else {
 		sb.WriteString(fmt.Sprintf("cp %d ", s.Score.Centipawn))
 	}
+	if s.Score.LowerBound {
+		sb.WriteString("lowerbound ")
+	} else if s.Score.UpperBound {
+		sb.WriteString("upperbound ")
+	}
+	if uci.engine.ShowWDL.Val {
+		sb.WriteString(fmt.Sprintf("wdl %d %d %d ", s.WDL.Win, s.WDL.Draw, s.WDL.Loss))
+	}
 	sb.WriteString(fmt.Sprintf("nps %d ", s.Nps))
 	sb.WriteString(fmt.Sprintf("time %d ", s.Duration))
+	sb.WriteString(fmt.Sprintf("hashfull %d ", s.HashFull))
+	sb.WriteString(fmt.Sprintf("tbhits %d ", s.TbHits))
 
 	sb.WriteString("pv ")
 	for _, move := range s.Moves {
-		sb.WriteString(move.String())
+		sb.WriteString(uci.moveString(move))
 		sb.WriteString(" ")
 	}
 	sb.WriteString("\n")
@@ -256,20 +401,43 @@ func updateUci(s SearchInfo) {
 }
 
 func (uci *UciProtocol) setOptionCommand(fields ...string) {
-	if len(fields) < 4 {
+	if len(fields) < 2 {
 		debugUci("invalid setoption arguments")
 		return
 	}
 
-	valIdx := findIndexString(fields, "value")
-	name := strings.Join(fields[1:valIdx], " ")
-	value := fields[valIdx+1]
+	// Buttons are set without value
+	var name, value string
+	if valIdx := findIndexString(fields, "value"); valIdx == -1 {
+		name = strings.Join(fields[1:], " ")
+	} else {
+		name = strings.Join(fields[1:valIdx], " ")
+		value = strings.Join(fields[valIdx+1:], " ")
+	}
 
 	for _, option := range uci.engine.GetOptions() {
 		if strings.EqualFold(option.GetName(), name) {
 			err := option.SetValue(value)
 			if err != nil {
 				debugUci(err.Error())
+				return
+			}
+			uci.waitChan = make(chan interface{})
+			defer close(uci.waitChan)
+			uci.engine.ApplyOptions()
+			if option == EngineOption(&uci.engine.BookFile) {
+				if err := uci.engine.BookError(); err != nil {
+					debugUci("Could not load book: " + err.Error())
+				}
+			}
+			if option == EngineOption(&uci.engine.SyzygyPath) {
+				if err := uci.engine.TablebaseError(); err != nil {
+					debugUci("Could not load tablebases: " + err.Error())
+				}
+			}
+			if (option == EngineOption(&uci.engine.Threads) || option == EngineOption(&uci.engine.Deterministic)) &&
+				uci.engine.Deterministic.Val && uci.engine.Threads.Val > 1 {
+				debugUci("Deterministic search uses one thread, Threads is ignored")
 			}
 			return
 		}